@@ -0,0 +1,220 @@
+// Package calendar models exchange trading sessions: the overnight session
+// that opens the evening before its trade date, the daily maintenance
+// break, regular trading hours, holidays and early closes. Times are
+// evaluated in the exchange's own time zone, so DST is handled by the zone
+// rules; the zone database is embedded so it resolves on any host.
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// Session labels, matching core.Tick.Session.
+const (
+	RTH    = "RTH"
+	ETH    = "ETH"
+	Closed = "CLOSED"
+)
+
+// Clock is a time of day in minutes after midnight.
+type Clock int
+
+// At returns the Clock for hour:minute.
+func At(hour, minute int) Clock {
+	return Clock(hour*60 + minute)
+}
+
+// ParseClock parses "HH:MM".
+func ParseClock(value string) (Clock, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("bad time of day %q", value)
+	}
+	return At(t.Hour(), t.Minute()), nil
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60)
+}
+
+// On is the instant at c on date's calendar day, in date's zone.
+func (c Clock) On(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), int(c)/60, int(c)%60, 0, 0, date.Location())
+}
+
+// Holiday is a trade date with a special schedule. Close is the early
+// close; zero means the market is closed all day.
+type Holiday struct {
+	Name  string
+	Close Clock
+}
+
+// Calendar is an exchange's weekly session schedule. A session opening at
+// Open on the evening before its trade date (Open after Close) runs
+// overnight; the gap between Close and the next Open is the daily
+// maintenance break. RTHOpen and RTHClose bound regular trading hours and
+// may be zero when the contract has none.
+type Calendar struct {
+	Location *time.Location
+	Open     Clock
+	Close    Clock
+	RTHOpen  Clock
+	RTHClose Clock
+	// Holidays reports the special schedule for a trade date, if any.
+	Holidays func(date time.Time) (Holiday, bool)
+}
+
+// Day is one trade date's schedule. Open may fall on the previous
+// calendar day.
+type Day struct {
+	Date     time.Time
+	Open     time.Time
+	Close    time.Time
+	RTHOpen  time.Time
+	RTHClose time.Time
+	Holiday  string
+	Closed   bool
+}
+
+// CMEEquity is the CME Globex schedule for equity-index futures (ES, NQ,
+// YM, RTY and the micros): 17:00-16:00 Central with RTH 08:30-15:15.
+func CMEEquity() *Calendar {
+	loc, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		// The embedded zone database always has it.
+		panic(err)
+	}
+	return &Calendar{
+		Location: loc,
+		Open:     At(17, 0),
+		Close:    At(16, 0),
+		RTHOpen:  At(8, 30),
+		RTHClose: At(15, 15),
+		Holidays: CMEEquityHolidays,
+	}
+}
+
+// ForContract builds the calendar for a contract's trading hours, written
+// as "17:00-16:00 America/Chicago". CME and CBOT contracts get the CME
+// equity-index RTH window and holiday schedule.
+func ForContract(exchange, tradingHours string) (*Calendar, error) {
+	fields := strings.Fields(tradingHours)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("trading hours %q: want \"HH:MM-HH:MM Zone\"", tradingHours)
+	}
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("trading hours %q: want \"HH:MM-HH:MM Zone\"", tradingHours)
+	}
+	open, err := ParseClock(bounds[0])
+	if err != nil {
+		return nil, err
+	}
+	closing, err := ParseClock(bounds[1])
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("trading hours %q: %w", tradingHours, err)
+	}
+	cal := &Calendar{Location: loc, Open: open, Close: closing}
+	switch strings.ToUpper(exchange) {
+	case "CME", "CBOT":
+		cme := CMEEquity()
+		cal.RTHOpen, cal.RTHClose, cal.Holidays = cme.RTHOpen, cme.RTHClose, cme.Holidays
+	}
+	return cal, nil
+}
+
+// overnight reports whether sessions open the evening before their date.
+func (c *Calendar) overnight() bool {
+	return c.Open > c.Close
+}
+
+// TradeDate is the trade date an instant belongs to, as midnight in the
+// calendar's zone. Instants after the evening open count toward the next
+// date; weekends and full closures roll forward to the next session, and
+// the maintenance break belongs to the session just closed.
+func (c *Calendar) TradeDate(t time.Time) time.Time {
+	local := t.In(c.Location)
+	date := midnight(local)
+	if c.overnight() && clockOf(local) >= c.Open {
+		date = date.AddDate(0, 0, 1)
+	}
+	for !c.trades(date) {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// Day returns the schedule for the trade date containing date's calendar
+// day.
+func (c *Calendar) Day(date time.Time) Day {
+	date = midnight(date.In(c.Location))
+	day := Day{Date: date, Close: c.Close.On(date)}
+	if c.overnight() {
+		day.Open = c.Open.On(date.AddDate(0, 0, -1))
+	} else {
+		day.Open = c.Open.On(date)
+	}
+	if c.RTHClose > c.RTHOpen {
+		day.RTHOpen = c.RTHOpen.On(date)
+		day.RTHClose = c.RTHClose.On(date)
+	}
+	if isWeekend(date) {
+		day.Closed = true
+		return day
+	}
+	if c.Holidays != nil {
+		if holiday, ok := c.Holidays(date); ok {
+			day.Holiday = holiday.Name
+			if holiday.Close == 0 {
+				day.Closed = true
+				return day
+			}
+			day.Close = holiday.Close.On(date)
+			if day.RTHClose.After(day.Close) {
+				day.RTHClose = day.Close
+			}
+		}
+	}
+	return day
+}
+
+// IsOpen reports whether the market trades at t.
+func (c *Calendar) IsOpen(t time.Time) bool {
+	day := c.Day(c.TradeDate(t))
+	return !day.Closed && !t.Before(day.Open) && t.Before(day.Close)
+}
+
+// Session labels t as RTH, ETH (open outside regular hours) or Closed.
+func (c *Calendar) Session(t time.Time) string {
+	day := c.Day(c.TradeDate(t))
+	if day.Closed || t.Before(day.Open) || !t.Before(day.Close) {
+		return Closed
+	}
+	if !day.RTHOpen.IsZero() && !t.Before(day.RTHOpen) && t.Before(day.RTHClose) {
+		return RTH
+	}
+	return ETH
+}
+
+func (c *Calendar) trades(date time.Time) bool {
+	return !c.Day(date).Closed
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func clockOf(t time.Time) Clock {
+	return At(t.Hour(), t.Minute())
+}
+
+func isWeekend(date time.Time) bool {
+	return date.Weekday() == time.Saturday || date.Weekday() == time.Sunday
+}
@@ -0,0 +1,158 @@
+package calendar
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Importance ranks an economic event's expected market impact.
+type Importance int
+
+const (
+	Low Importance = iota + 1
+	Medium
+	High
+)
+
+func (i Importance) String() string {
+	switch i {
+	case Low:
+		return "low"
+	case Medium:
+		return "medium"
+	case High:
+		return "high"
+	default:
+		return fmt.Sprintf("Importance(%d)", int(i))
+	}
+}
+
+// ParseImportance accepts low/medium/high or 1-3.
+func ParseImportance(value string) (Importance, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "low", "1":
+		return Low, nil
+	case "medium", "med", "2":
+		return Medium, nil
+	case "high", "3":
+		return High, nil
+	default:
+		return 0, fmt.Errorf("unknown importance %q (want low, medium or high)", value)
+	}
+}
+
+// Event is a scheduled economic release such as CPI, FOMC or NFP.
+type Event struct {
+	Time       time.Time
+	Name       string
+	Importance Importance
+}
+
+// eventRecord is an event as written in a JSON calendar file.
+type eventRecord struct {
+	Timestamp  string          `json:"timestamp"`
+	Event      string          `json:"event"`
+	Importance json.RawMessage `json:"importance"`
+}
+
+// LoadEvents reads an economic calendar, sorted by time. Files ending in
+// .json hold an array of {"timestamp", "event", "importance"} objects;
+// anything else is CSV with timestamp, event and importance columns.
+// Timestamps are RFC3339.
+func LoadEvents(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events []Event
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		events, err = readJSONEvents(file)
+	} else {
+		events, err = readCSVEvents(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("events %s: %w", path, err)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+func readJSONEvents(r io.Reader) ([]Event, error) {
+	var records []eventRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(records))
+	for i, record := range records {
+		importance := string(record.Importance)
+		if unquoted, err := strconv.Unquote(importance); err == nil {
+			importance = unquoted
+		}
+		event, err := parseEvent(record.Timestamp, record.Event, importance)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i+1, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func readCSVEvents(r io.Reader) ([]Event, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	idx := make(map[string]int, len(header))
+	for i, col := range header {
+		idx[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	for _, col := range []string{"timestamp", "event", "importance"} {
+		if _, ok := idx[col]; !ok {
+			return nil, fmt.Errorf("missing %s column", col)
+		}
+	}
+	var events []Event
+	for line := 2; ; line++ {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(col string) string {
+			if pos := idx[col]; pos < len(rec) {
+				return strings.TrimSpace(rec[pos])
+			}
+			return ""
+		}
+		event, err := parseEvent(get("timestamp"), get("event"), get("importance"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+}
+
+func parseEvent(timestamp, name, importance string) (Event, error) {
+	ts, err := time.Parse(time.RFC3339, strings.TrimSpace(timestamp))
+	if err != nil {
+		return Event{}, fmt.Errorf("bad timestamp %q", timestamp)
+	}
+	level, err := ParseImportance(importance)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Time: ts, Name: strings.TrimSpace(name), Importance: level}, nil
+}
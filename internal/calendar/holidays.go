@@ -0,0 +1,123 @@
+package calendar
+
+import "time"
+
+// CMEEquityHolidays is the CME Globex holiday schedule for equity-index
+// futures, computed from the US exchange holiday rules:
+//   - closed on New Year's Day, Good Friday and Christmas;
+//   - early close at 12:00 CT on the other exchange holidays (Martin Luther
+//     King Jr. Day, Presidents Day, Memorial Day, Juneteenth, Independence
+//     Day, Labor Day, Thanksgiving);
+//   - early close at 12:15 CT on the day after Thanksgiving, Christmas Eve
+//     and the day before Independence Day.
+//
+// Holidays falling on a Sunday are observed on Monday and those on a
+// Saturday on Friday, except New Year's Day, which is not moved into the
+// previous year.
+func CMEEquityHolidays(date time.Time) (Holiday, bool) {
+	year, month, day := date.Date()
+	on := func(m time.Month, d int) bool { return month == m && day == d }
+	is := func(t time.Time) bool { return on(t.Month(), t.Day()) && t.Year() == year }
+
+	closed := []struct {
+		name string
+		date time.Time
+	}{
+		{"New Year's Day", newYearsDay(year)},
+		{"Good Friday", easter(year).AddDate(0, 0, -2)},
+		{"Christmas", observed(dateOf(year, time.December, 25))},
+	}
+	for _, h := range closed {
+		if is(h.date) {
+			return Holiday{Name: h.name}, true
+		}
+	}
+
+	early := []struct {
+		name string
+		date time.Time
+	}{
+		{"Martin Luther King Jr. Day", nthWeekday(year, time.January, time.Monday, 3)},
+		{"Presidents Day", nthWeekday(year, time.February, time.Monday, 3)},
+		{"Memorial Day", lastWeekday(year, time.May, time.Monday)},
+		{"Independence Day", observed(dateOf(year, time.July, 4))},
+		{"Labor Day", nthWeekday(year, time.September, time.Monday, 1)},
+		{"Thanksgiving", nthWeekday(year, time.November, time.Thursday, 4)},
+	}
+	if year >= 2022 {
+		early = append(early, struct {
+			name string
+			date time.Time
+		}{"Juneteenth", observed(dateOf(year, time.June, 19))})
+	}
+	for _, h := range early {
+		if is(h.date) {
+			return Holiday{Name: h.name, Close: At(12, 0)}, true
+		}
+	}
+
+	switch {
+	case is(nthWeekday(year, time.November, time.Thursday, 4).AddDate(0, 0, 1)):
+		return Holiday{Name: "Day after Thanksgiving", Close: At(12, 15)}, true
+	case on(time.December, 24) && !is(observed(dateOf(year, time.December, 25))):
+		return Holiday{Name: "Christmas Eve", Close: At(12, 15)}, true
+	case on(time.July, 3) && !is(observed(dateOf(year, time.July, 4))):
+		return Holiday{Name: "Independence Day Eve", Close: At(12, 15)}, true
+	}
+	return Holiday{}, false
+}
+
+func dateOf(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// observed moves a weekend holiday to the nearest weekday.
+func observed(date time.Time) time.Time {
+	switch date.Weekday() {
+	case time.Saturday:
+		return date.AddDate(0, 0, -1)
+	case time.Sunday:
+		return date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+func newYearsDay(year int) time.Time {
+	date := dateOf(year, time.January, 1)
+	if date.Weekday() == time.Sunday {
+		return date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// nthWeekday is the nth weekday of a month, counting from 1.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	date := dateOf(year, month, 1)
+	offset := (int(weekday) - int(date.Weekday()) + 7) % 7
+	return date.AddDate(0, 0, offset+7*(n-1))
+}
+
+func lastWeekday(year int, month time.Month, weekday time.Weekday) time.Time {
+	date := dateOf(year, month+1, 1).AddDate(0, 0, -1)
+	offset := (int(date.Weekday()) - int(weekday) + 7) % 7
+	return date.AddDate(0, 0, -offset)
+}
+
+// easter is Easter Sunday (anonymous Gregorian algorithm).
+func easter(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return dateOf(year, time.Month(month), day)
+}
@@ -2,20 +2,36 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"log"
+	"math"
 	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"trading-algo-generator/internal/calendar"
 	"trading-algo-generator/internal/config"
+	"trading-algo-generator/internal/contracts"
 	"trading-algo-generator/internal/core"
 	"trading-algo-generator/internal/eval"
 	"trading-algo-generator/internal/execution"
 	"trading-algo-generator/internal/features"
+	"trading-algo-generator/internal/fix"
 	"trading-algo-generator/internal/ingestion"
+	"trading-algo-generator/internal/paper"
+	"trading-algo-generator/internal/portfolio"
 	"trading-algo-generator/internal/replay"
 	"trading-algo-generator/internal/risk"
+	"trading-algo-generator/internal/sizing"
 	"trading-algo-generator/internal/storage"
+	"trading-algo-generator/internal/strategy"
+	"trading-algo-generator/internal/strategy/ensemble"
+	// Strategies outside package strategy register themselves on import.
+	_ "trading-algo-generator/internal/strategy/rules"
 )
 
 func Run() error {
@@ -35,13 +51,17 @@ func Run() error {
 		return runCmd(os.Args[2:])
 	case "dashboard":
 		return dashboardCmd(os.Args[2:])
+	case "exchange":
+		return exchangeCmd(os.Args[2:])
+	case "strategies":
+		return strategiesCmd(os.Args[2:])
 	default:
 		return usage()
 	}
 }
 
 func usage() error {
-	fmt.Fprintln(os.Stderr, "Usage: tagen <ingest|features|replay|live|run|dashboard> [args]")
+	fmt.Fprintln(os.Stderr, "Usage: tagen <ingest|features|replay|live|run|dashboard|exchange|strategies> [args]")
 	return fmt.Errorf("invalid command")
 }
 
@@ -49,14 +69,19 @@ func ingestCmd(args []string) error {
 	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
 	input := fs.String("input", "", "path to CSV input")
 	output := fs.String("output", "", "path to tick store")
+	calendarName := fs.String("calendar", "cme", "exchange calendar labelling rows without a session (cme|none)")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	if *input == "" || *output == "" {
 		return fmt.Errorf("input and output required")
 	}
+	cal, err := parseCalendar(*calendarName)
+	if err != nil {
+		return err
+	}
 
-	reader := ingestion.CSVReader{Path: *input}
+	reader := ingestion.CSVReader{Path: *input, Calendar: cal}
 	ticks, errs := reader.Stream()
 	store := storage.TickStore{Path: *output}
 	pipeline := ingestion.Pipeline{Store: &store}
@@ -68,27 +93,24 @@ func featuresCmd(args []string) error {
 	fs := flag.NewFlagSet("features", flag.ExitOnError)
 	input := fs.String("input", "", "path to tick store")
 	output := fs.String("output", "", "path to feature CSV")
+	calendarName := fs.String("calendar", "cme", "exchange calendar for session and time features (cme|none)")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	if *input == "" || *output == "" {
 		return fmt.Errorf("input and output required")
 	}
+	cal, err := parseCalendar(*calendarName)
+	if err != nil {
+		return err
+	}
 
 	store := storage.TickStore{Path: *input}
 	ticks, err := store.LoadAll()
 	if err != nil {
 		return err
 	}
-	engine := features.Engine{
-		Generators: []features.Generator{
-			&features.OHLCVGenerator{Window: 20},
-			features.DeltaGenerator{},
-			features.VolumeProfileGenerator{},
-			features.SessionGenerator{},
-			features.TimeGenerator{},
-		},
-	}
+	engine := features.Engine{Generators: features.DefaultGenerators(cal)}
 	featureSets := make([]core.FeatureSet, 0, len(ticks))
 	for _, tick := range ticks {
 		featureSets = append(featureSets, engine.Build(tick))
@@ -136,58 +158,165 @@ func liveCmd(args []string) error {
 	fs := flag.NewFlagSet("live", flag.ExitOnError)
 	input := fs.String("input", "", "path to tick store")
 	configPath := fs.String("config", "", "path to strategy config")
+	contractsPath := fs.String("contracts", "", "path to contract specs (defaults to built-in CME index specs)")
 	speed := fs.Float64("speed", 1, "replay speed factor")
+	brokerName := fs.String("broker", "mock", "broker: mock, paper, fix or fix-loopback")
+	exchangeAddr := fs.String("exchange", "127.0.0.1:7001", "exchange simulator address for the paper broker")
+	fixAddr := fs.String("fix-addr", "127.0.0.1:9878", "FIX acceptor address for the fix broker")
+	fixSender := fs.String("fix-sender", "TAGEN", "FIX SenderCompID")
+	fixTarget := fs.String("fix-target", "BROKER", "FIX TargetCompID")
+	fixStore := fs.String("fix-store", "", "file persisting FIX sequence numbers (in memory if empty)")
+	fixReset := fs.Bool("fix-reset", false, "reset FIX sequence numbers on logon")
+	reconcile := fs.String("reconcile", "", "reconcile policy overriding the config: adopt, flatten, halt or off")
+	checkpointPath := fs.String("checkpoint", "", "file to checkpoint engine state to")
+	checkpointEvery := fs.Int("checkpoint-every", 1, "bars between checkpoints; bars that send orders or apply order events are always checkpointed")
+	resume := fs.Bool("resume", false, "restore state from --checkpoint and skip the ticks it already covers")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	if *input == "" || *configPath == "" {
 		return fmt.Errorf("input and config required")
 	}
+	if *resume && *checkpointPath == "" {
+		return fmt.Errorf("resume requires checkpoint")
+	}
 
-	cfg, err := config.LoadStrategyConfig(*configPath)
+	engine, err := buildEngine(*configPath, *contractsPath)
 	if err != nil {
 		return err
 	}
-	applyRiskTickSize(&cfg)
-	strat, err := config.BuildStrategy(cfg)
-	if err != nil {
-		return err
+	if *reconcile != "" {
+		if engine.ReconcilePolicy, err = core.ParseReconcilePolicy(*reconcile); err != nil {
+			return err
+		}
+	}
+	// remote is set for brokers whose connection can fail mid-run.
+	var remote interface{ Err() error }
+	switch *brokerName {
+	case "mock":
+	case "paper":
+		paperBroker, err := paper.Dial(*exchangeAddr)
+		if err != nil {
+			return err
+		}
+		defer paperBroker.Close()
+		engine.Broker = paperBroker
+		remote = paperBroker
+	case "fix":
+		var store fix.Store = &fix.MemoryStore{}
+		if *fixStore != "" {
+			store = fix.FileStore{Path: *fixStore}
+		}
+		settings := fix.SessionSettings{SenderCompID: *fixSender, TargetCompID: *fixTarget, ResetSeqNums: *fixReset}
+		initiator, err := fix.Dial(*fixAddr, settings, store, engine.Symbol, log.New(os.Stderr, "fix: ", log.LstdFlags))
+		if err != nil {
+			return err
+		}
+		defer initiator.Close()
+		engine.Broker = initiator
+		remote = initiator
+	case "fix-loopback":
+		// The in-process acceptor fills with the same costs and book
+		// settings the mock broker would have used.
+		mock := engine.Broker.(*execution.MockBroker)
+		acceptor := &fix.Acceptor{
+			Settings: fix.SessionSettings{SenderCompID: *fixTarget, TargetCompID: *fixSender, ResetSeqNums: true},
+			Costs:    mock.Costs,
+			Book:     mock.Book.Settings,
+			Calendar: mock.Book.Calendar,
+		}
+		logger := log.New(os.Stderr, "fix: ", log.LstdFlags)
+		loopback, err := fix.NewLoopback(acceptor, nil, engine.Symbol, logger)
+		if err != nil {
+			return err
+		}
+		defer loopback.Close()
+		engine.Broker = loopback
+		remote = loopback
+	default:
+		return fmt.Errorf("unknown broker %q", *brokerName)
+	}
+
+	checkpoints := storage.CheckpointStore{Path: *checkpointPath}
+	sim := ingestion.LiveSimulator{Speed: *speed}
+	if *resume {
+		if err := restoreCheckpoint(checkpoints, engine); err != nil {
+			return err
+		}
+		sim.After = engine.LastBar()
+		engine.Logger.Printf("resumed from %s at %s", *checkpointPath, sim.After.Format(time.RFC3339))
 	}
 
 	store := storage.TickStore{Path: *input}
 	tickStream, errStream := store.Stream()
-	sim := ingestion.LiveSimulator{Speed: *speed}
 	liveTicks := sim.Stream(tickStream)
 
-	engine := core.Engine{
-		Strategy: strat,
-		Features: features.Engine{Generators: []features.Generator{
-			&features.OHLCVGenerator{Window: 20},
-			features.DeltaGenerator{},
-			features.VolumeProfileGenerator{},
-			features.SessionGenerator{},
-			features.TimeGenerator{},
-		}},
-		Risk: &risk.Manager{Settings: cfg.Risk},
-		Broker: &execution.MockBroker{},
-		Evaluator: &eval.Evaluator{},
-		TickSize: cfg.TickSize,
-		TradeSize: cfg.Size,
-		Symbol: cfg.Symbol,
-	}
-	if err := engine.Validate(); err != nil {
-		return err
-	}
-
+	bars := 0
+	activity := engine.Activity()
 	for tick := range liveTicks {
 		if err := engine.OnTick(tick); err != nil {
 			return err
 		}
+		if remote != nil {
+			if err := remote.Err(); err != nil {
+				return err
+			}
+		}
+		bars++
+		// A bar that moved orders is saved at once: resuming from an older
+		// checkpoint would send them again.
+		traded := engine.Activity() != activity
+		activity = engine.Activity()
+		if *checkpointPath != "" && (traded || (*checkpointEvery > 0 && bars%*checkpointEvery == 0)) {
+			if err := saveCheckpoint(checkpoints, engine); err != nil {
+				return err
+			}
+		}
 	}
 	if err := <-errStream; err != nil {
 		return err
 	}
-	printDashboard(&engine)
+	if *checkpointPath != "" {
+		if err := saveCheckpoint(checkpoints, engine); err != nil {
+			return err
+		}
+	}
+	printDashboard(engine)
+	return nil
+}
+
+// saveCheckpoint writes the engine's state, and the broker's when it runs
+// in-process, between bars.
+func saveCheckpoint(store storage.CheckpointStore, engine *core.Engine) error {
+	state, err := engine.Snapshot()
+	if err != nil {
+		return err
+	}
+	checkpoint := storage.Checkpoint{SavedAt: time.Now().UTC(), Symbol: engine.Symbol, Engine: state}
+	if broker, ok := engine.Broker.(core.Snapshotter); ok {
+		if checkpoint.Broker, err = broker.Snapshot(); err != nil {
+			return fmt.Errorf("snapshot broker: %w", err)
+		}
+	}
+	return store.Save(checkpoint)
+}
+
+func restoreCheckpoint(store storage.CheckpointStore, engine *core.Engine) error {
+	checkpoint, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if checkpoint.Symbol != engine.Symbol {
+		return fmt.Errorf("checkpoint %s is for %s, not %s", store.Path, checkpoint.Symbol, engine.Symbol)
+	}
+	if err := engine.Restore(checkpoint.Engine); err != nil {
+		return err
+	}
+	if broker, ok := engine.Broker.(core.Snapshotter); ok && len(checkpoint.Broker) > 0 {
+		if err := broker.Restore(checkpoint.Broker); err != nil {
+			return fmt.Errorf("restore broker: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -195,19 +324,19 @@ func runCmd(args []string) error {
 	fs := flag.NewFlagSet("run", flag.ExitOnError)
 	input := fs.String("input", "", "path to tick store")
 	configPath := fs.String("config", "", "path to strategy config")
+	portfolioPath := fs.String("portfolio", "", "path to a portfolio config, run instead of --config")
+	contractsPath := fs.String("contracts", "", "path to contract specs (defaults to built-in CME index specs)")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	if *input != "" && *portfolioPath != "" {
+		return runPortfolio(*input, *portfolioPath, *contractsPath)
+	}
 	if *input == "" || *configPath == "" {
-		return fmt.Errorf("input and config required")
+		return fmt.Errorf("input and config (or portfolio) required")
 	}
 
-	cfg, err := config.LoadStrategyConfig(*configPath)
-	if err != nil {
-		return err
-	}
-	applyRiskTickSize(&cfg)
-	strat, err := config.BuildStrategy(cfg)
+	router, err := buildRouter(*configPath, *contractsPath)
 	if err != nil {
 		return err
 	}
@@ -216,41 +345,197 @@ func runCmd(args []string) error {
 	if err != nil {
 		return err
 	}
-	engine := core.Engine{
-		Strategy: strat,
-		Features: features.Engine{Generators: []features.Generator{
-			&features.OHLCVGenerator{Window: 20},
-			features.DeltaGenerator{},
-			features.VolumeProfileGenerator{},
-			features.SessionGenerator{},
-			features.TimeGenerator{},
-		}},
-		Risk: &risk.Manager{Settings: cfg.Risk},
-		Broker: &execution.MockBroker{},
-		Evaluator: &eval.Evaluator{},
-		TickSize: cfg.TickSize,
-		TradeSize: cfg.Size,
-		Symbol: cfg.Symbol,
+	for _, tick := range ticks {
+		if err := router.OnTick(tick); err != nil {
+			return err
+		}
 	}
-	if err := engine.Validate(); err != nil {
+	if err := router.Flush("end_of_data"); err != nil {
 		return err
 	}
-	for _, tick := range ticks {
-		if err := engine.OnTick(tick); err != nil {
+	if len(router.Engines) > 1 {
+		for _, symbol := range router.Symbols() {
+			fmt.Printf("== %s\n", symbol)
+			printSummary(router.Engines[symbol].Evaluator.Summary())
+		}
+		fmt.Println("== account")
+	}
+	printSummary(router.Summary())
+	for _, symbol := range router.Symbols() {
+		engine := router.Engines[symbol]
+		if members, ok := engine.Strategy.(*ensemble.Strategy); ok {
+			stats, unattributed := members.Attribute(engine.Evaluator.Trades)
+			printAttribution(symbol, stats, unattributed)
+		}
+	}
+	skipped := make([]string, 0, len(router.Skipped))
+	for symbol := range router.Skipped {
+		skipped = append(skipped, symbol)
+	}
+	sort.Strings(skipped)
+	for _, symbol := range skipped {
+		fmt.Printf("Skipped %d ticks for untraded symbol %q\n", router.Skipped[symbol], symbol)
+	}
+	return nil
+}
+
+// runPortfolio runs every strategy of a portfolio config over the ticks
+// and prints each one's results, the combined results, the daily equity
+// curves and the correlation of daily returns.
+func runPortfolio(input, portfolioPath, contractsPath string) error {
+	runner, err := buildPortfolio(portfolioPath, contractsPath)
+	if err != nil {
+		return err
+	}
+	store := storage.TickStore{Path: input}
+	ticks, errs := store.Stream()
+	for tick := range ticks {
+		if err := runner.OnTick(tick); err != nil {
 			return err
 		}
 	}
-	summary := engine.Evaluator.Summary()
-	fmt.Printf("Trades: %d Wins: %d Losses: %d WinRate: %.2f Expectancy: %.2f MaxDD: %.2f\n",
-		summary.TotalTrades, summary.Wins, summary.Losses, summary.WinRate, summary.Expectancy, summary.MaxDrawdown)
-	fmt.Printf("Win/Loss Distribution: %+v\n", summary.WinLossDist)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := runner.Flush("end_of_data"); err != nil {
+		return err
+	}
+	printPortfolio(runner)
 	return nil
 }
 
+// buildPortfolio builds a router per portfolio strategy, all held to the
+// portfolio's account limits. Each strategy's sizer starts from its
+// allocation of the starting equity. Under netted positions the strategies
+// trade without costs and the account pays the first listed config's costs
+// for each symbol on the net change.
+func buildPortfolio(path, contractsPath string) (*portfolio.Runner, error) {
+	pcfg, err := config.LoadPortfolioConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := portfolio.ParsePolicy(pcfg.Positions)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := config.LoadContracts(contractsPath)
+	if err != nil {
+		return nil, err
+	}
+	account := &risk.Account{Settings: pcfg.Account}
+	runner := &portfolio.Runner{Policy: policy}
+	names := map[string]bool{}
+	for _, member := range pcfg.Strategies {
+		cfg, err := config.LoadStrategyConfig(member.Config)
+		if err != nil {
+			return nil, err
+		}
+		name := member.Name
+		if name == "" {
+			name = cfg.Name
+		}
+		if names[name] {
+			return nil, fmt.Errorf("portfolio strategy %s listed twice; give each a name", name)
+		}
+		names[name] = true
+		capital := member.Allocation * pcfg.StartingEquity
+		if capital > 0 {
+			cfg.Sizing.StartingEquity = capital
+		}
+		costs := cfg.Costs
+		if policy == portfolio.Netted {
+			cfg.Costs = execution.CostSettings{}
+		}
+		router, err := newRouter(cfg, registry, account, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, engine := range router.Engines {
+			model, err := execution.NewCostModel(costs, engine.Contract.TickSize)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			runner.AddBook(engine.Symbol, engine.Contract, model)
+		}
+		runner.Strategies = append(runner.Strategies, portfolio.Strategy{Name: name, Capital: capital, Router: router})
+	}
+	runner.Calendar = account.Calendar
+	return runner, nil
+}
+
+func printPortfolio(runner *portfolio.Runner) {
+	report := runner.Report()
+	for i, name := range report.Names {
+		fmt.Printf("== %s (capital %.2f)\n", name, runner.Strategies[i].Capital)
+		printSummary(report.Summaries[i])
+	}
+	fmt.Printf("== portfolio (%s)\n", report.Policy)
+	printSummary(report.Combined)
+	if report.Policy == portfolio.Netted {
+		var equity float64
+		if n := len(report.AccountEquity); n > 0 {
+			equity = report.AccountEquity[n-1]
+		}
+		fmt.Printf("Netted: contracts %d (strategies %d) realized %.2f unrealized %.2f costs %.2f net PnL %.2f\n",
+			report.Contracts, report.StrategyContracts, report.NetRealized, report.NetUnrealized, report.NetCosts, equity)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Println("Daily Equity:")
+	fmt.Fprintf(w, "date\t%s\taccount\t\n", strings.Join(report.Names, "\t"))
+	for d, date := range report.Dates {
+		row := []string{date.Format("2006-01-02")}
+		for i := range report.Names {
+			row = append(row, fmt.Sprintf("%.2f", report.Equity[i][d]))
+		}
+		row = append(row, fmt.Sprintf("%.2f", report.AccountEquity[d]))
+		fmt.Fprintf(w, "%s\t\n", strings.Join(row, "\t"))
+	}
+	w.Flush()
+	fmt.Println("Daily Return Correlation:")
+	fmt.Fprintf(w, "\t%s\t\n", strings.Join(report.Names, "\t"))
+	for i, name := range report.Names {
+		row := []string{name}
+		for j := range report.Names {
+			if math.IsNaN(report.Correlation[i][j]) {
+				row = append(row, "n/a")
+			} else {
+				row = append(row, fmt.Sprintf("%.2f", report.Correlation[i][j]))
+			}
+		}
+		fmt.Fprintf(w, "%s\t\n", strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+func printSummary(summary eval.Summary) {
+	fmt.Printf("Trades: %d Wins: %d Losses: %d WinRate: %.2f Expectancy: %.2f PnL: %.2f %s MaxDD: %.2f\n",
+		summary.TotalTrades, summary.Wins, summary.Losses, summary.WinRate, summary.Expectancy, summary.TotalPnL, summary.Currency, summary.MaxDrawdown)
+	fmt.Printf("Gross: %.2f Commission: %.2f Fees: %.2f Slippage: %.2f Net: %.2f %s\n",
+		summary.GrossPnL, summary.Commission, summary.Fees, summary.Slippage, summary.TotalPnL, summary.Currency)
+	fmt.Printf("Win/Loss Distribution: %+v\n", summary.WinLossDist)
+	fmt.Printf("Exit Reasons: %+v\n", summary.ExitReasons)
+	fmt.Printf("Blocked Signals: %+v\n", summary.BlockedSignals)
+	fmt.Printf("Risk Triggers: %+v\n", summary.RiskTriggers)
+}
+
+// printAttribution prints an ensemble's results per member, crediting each
+// member with the trades it voted for.
+func printAttribution(symbol string, stats []ensemble.MemberStats, unattributed int) {
+	fmt.Printf("Member Attribution (%s):\n", symbol)
+	for _, member := range stats {
+		fmt.Printf("  %s: Trades: %d Wins: %d PnL: %.2f\n", member.Member, member.Trades, member.Wins, member.PnL)
+	}
+	if unattributed > 0 {
+		fmt.Printf("  unattributed: Trades: %d\n", unattributed)
+	}
+}
+
 func dashboardCmd(args []string) error {
 	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
 	input := fs.String("input", "", "path to tick store")
 	configPath := fs.String("config", "", "path to strategy config")
+	contractsPath := fs.String("contracts", "", "path to contract specs (defaults to built-in CME index specs)")
 	refresh := fs.Duration("refresh", 2*time.Second, "dashboard refresh interval")
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -259,12 +544,7 @@ func dashboardCmd(args []string) error {
 		return fmt.Errorf("input and config required")
 	}
 
-	cfg, err := config.LoadStrategyConfig(*configPath)
-	if err != nil {
-		return err
-	}
-	applyRiskTickSize(&cfg)
-	strat, err := config.BuildStrategy(cfg)
+	engine, err := buildEngine(*configPath, *contractsPath)
 	if err != nil {
 		return err
 	}
@@ -275,26 +555,6 @@ func dashboardCmd(args []string) error {
 		return err
 	}
 
-	engine := core.Engine{
-		Strategy: strat,
-		Features: features.Engine{Generators: []features.Generator{
-			&features.OHLCVGenerator{Window: 20},
-			features.DeltaGenerator{},
-			features.VolumeProfileGenerator{},
-			features.SessionGenerator{},
-			features.TimeGenerator{},
-		}},
-		Risk: &risk.Manager{Settings: cfg.Risk},
-		Broker: &execution.MockBroker{},
-		Evaluator: &eval.Evaluator{},
-		TickSize: cfg.TickSize,
-		TradeSize: cfg.Size,
-		Symbol: cfg.Symbol,
-	}
-	if err := engine.Validate(); err != nil {
-		return err
-	}
-
 	stop := make(chan struct{})
 	go func() {
 		ticker := time.NewTicker(*refresh)
@@ -302,7 +562,7 @@ func dashboardCmd(args []string) error {
 		for {
 			select {
 			case <-ticker.C:
-				printDashboard(&engine)
+				printDashboard(engine)
 			case <-stop:
 				return
 			}
@@ -315,7 +575,7 @@ func dashboardCmd(args []string) error {
 		}
 	}
 	close(stop)
-	printDashboard(&engine)
+	printDashboard(engine)
 	return nil
 }
 
@@ -329,8 +589,246 @@ func printDashboard(engine *core.Engine) {
 			pos = "SHORT"
 		}
 	}
-	fmt.Printf("POS: %s Trades: %d WinRate: %.2f Expectancy: %.2f DailyPnL: %.2f\n",
-		pos, summary.TotalTrades, summary.WinRate, summary.Expectancy, engine.Risk.DailyPnL)
+	fmt.Printf("POS: %s Risk: %.2f Trades: %d WinRate: %.2f Expectancy: %.2f DailyPnL: %.2f %s\n",
+		pos, engine.Risk.StopRisk(engine.Position), summary.TotalTrades, summary.WinRate, summary.Expectancy, engine.Risk.DailyPnL, summary.Currency)
+}
+
+func exchangeCmd(args []string) error {
+	fs := flag.NewFlagSet("exchange", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:7001", "address to accept paper broker connections on")
+	configPath := fs.String("config", "", "optional strategy config whose costs and book settings the exchange applies")
+	contractsPath := fs.String("contracts", "", "path to contract specs (defaults to built-in CME index specs)")
+	latency := fs.Duration("latency", 0, "simulated delay before each request is processed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sim := &paper.Simulator{
+		Costs:   execution.NoCosts{},
+		Latency: *latency,
+		Logger:  log.New(os.Stderr, "exchange: ", log.LstdFlags),
+	}
+	if *configPath != "" {
+		cfg, contract, err := loadStrategyConfig(*configPath, *contractsPath)
+		if err != nil {
+			return err
+		}
+		costs, err := execution.NewCostModel(cfg.Costs, cfg.TickSize)
+		if err != nil {
+			return err
+		}
+		cal, err := contractCalendar(contract)
+		if err != nil {
+			return err
+		}
+		sim.Costs = costs
+		sim.Book = cfg.Book
+		sim.Calendar = cal
+	}
+	sim.Logger.Printf("listening on %s", *listen)
+	return sim.ListenAndServe(*listen)
+}
+
+// strategiesCmd lists the registered strategies and their parameters.
+func strategiesCmd(args []string) error {
+	fs := flag.NewFlagSet("strategies", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the schemas as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	definitions := strategy.Registered()
+	if *asJSON {
+		type schema struct {
+			Name        string           `json:"name"`
+			Description string           `json:"description"`
+			Params      []strategy.Param `json:"params"`
+		}
+		schemas := make([]schema, 0, len(definitions))
+		for _, definition := range definitions {
+			schemas = append(schemas, schema{Name: definition.Name, Description: definition.Description, Params: definition.Schema()})
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(schemas)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, definition := range definitions {
+		fmt.Fprintf(w, "%s\t%s\n", definition.Name, definition.Description)
+		for _, param := range definition.Schema() {
+			fmt.Fprintf(w, "  %s\t%s\tdefault %v\t%s\n", param.Name, param.Type, param.Default, param.Description)
+		}
+	}
+	return w.Flush()
+}
+
+// loadStrategyConfig loads a strategy config and resolves its contract.
+func loadStrategyConfig(configPath, contractsPath string) (config.StrategyConfig, contracts.Spec, error) {
+	cfg, err := config.LoadStrategyConfig(configPath)
+	if err != nil {
+		return cfg, contracts.Spec{}, err
+	}
+	registry, err := config.LoadContracts(contractsPath)
+	if err != nil {
+		return cfg, contracts.Spec{}, err
+	}
+	contract, err := config.ResolveContract(&cfg, registry)
+	if err != nil {
+		return cfg, contracts.Spec{}, err
+	}
+	applyRiskTickSize(&cfg)
+	return cfg, contract, nil
+}
+
+func buildEngine(configPath, contractsPath string) (*core.Engine, error) {
+	cfg, contract, err := loadStrategyConfig(configPath, contractsPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Symbols) > 0 {
+		return nil, fmt.Errorf("%s lists symbols; multi-symbol configs run with tagen run", configPath)
+	}
+	return newEngine(cfg, contract)
+}
+
+// buildRouter builds an engine for each of the config's symbols, or its
+// single symbol, sharing one account-wide risk limit.
+func buildRouter(configPath, contractsPath string) (*core.Router, error) {
+	cfg, err := config.LoadStrategyConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := config.LoadContracts(contractsPath)
+	if err != nil {
+		return nil, err
+	}
+	return newRouter(cfg, registry, &risk.Account{Settings: cfg.Account}, "engine")
+}
+
+// newRouter builds an engine per symbol of a loaded config, held to
+// account's limits. Log lines start with prefix and the symbol.
+func newRouter(cfg config.StrategyConfig, registry *contracts.Registry, account *risk.Account, prefix string) (*core.Router, error) {
+	symbols := cfg.Symbols
+	if len(symbols) == 0 {
+		symbols = []string{cfg.Symbol}
+	}
+	engines := make([]*core.Engine, 0, len(symbols))
+	for _, symbol := range symbols {
+		symbolCfg := cfg
+		symbolCfg.Symbol = symbol
+		if len(cfg.Symbols) > 0 {
+			// Each contract brings its own tick size.
+			symbolCfg.TickSize = 0
+			symbolCfg.Risk.TickSize = 0
+		}
+		contract, err := config.ResolveContract(&symbolCfg, registry)
+		if err != nil {
+			return nil, err
+		}
+		applyRiskTickSize(&symbolCfg)
+		engine, err := newEngine(symbolCfg, contract)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", symbol, err)
+		}
+		if account.Calendar == nil {
+			account.Calendar = engine.Risk.Calendar
+		}
+		engine.Account = account
+		engine.Logger = log.New(os.Stderr, fmt.Sprintf("%s %s: ", prefix, engine.Symbol), log.LstdFlags)
+		engines = append(engines, engine)
+	}
+	return core.NewRouter(engines...)
+}
+
+// newEngine builds an engine for a loaded config and its contract.
+func newEngine(cfg config.StrategyConfig, contract contracts.Spec) (*core.Engine, error) {
+	strat, err := config.BuildStrategy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	costs, err := execution.NewCostModel(cfg.Costs, cfg.TickSize)
+	if err != nil {
+		return nil, err
+	}
+	intrabar, err := core.ParseIntrabar(cfg.Intrabar)
+	if err != nil {
+		return nil, err
+	}
+	reconcile, err := core.ParseReconcilePolicy(cfg.Reconcile.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Risk.Session.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Risk.Events.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Risk.Volatility.Validate(); err != nil {
+		return nil, err
+	}
+	sizer, err := sizing.New(cfg.Sizing)
+	if err != nil {
+		return nil, err
+	}
+	var events []calendar.Event
+	if cfg.Risk.Events.File != "" {
+		if events, err = calendar.LoadEvents(cfg.Risk.Events.File); err != nil {
+			return nil, err
+		}
+	}
+	cal, err := contractCalendar(contract)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := &core.Engine{
+		Strategy:  strat,
+		Features:  features.Engine{Generators: features.DefaultGenerators(cal)},
+		Risk:      &risk.Manager{Settings: cfg.Risk, Contract: contract, Calendar: cal, Events: events},
+		Broker:    &execution.MockBroker{Costs: costs, Book: execution.OrderBook{Settings: cfg.Book, Calendar: cal}},
+		Evaluator: &eval.Evaluator{Contract: contract},
+		Contract:  contract,
+		Intrabar:  intrabar,
+		TickSize:  cfg.TickSize,
+		TradeSize: cfg.Size,
+		Sizer:     sizer,
+		Exits:     cfg.Exits,
+		Symbol:    cfg.Symbol,
+
+		ReconcilePolicy:  reconcile,
+		ReconcileEvery:   cfg.Reconcile.EveryBars,
+		ReconcileAckBars: cfg.Reconcile.AckBars,
+		Logger:           log.New(os.Stderr, "engine: ", log.LstdFlags),
+	}
+	if err := engine.Validate(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// contractCalendar builds the session calendar for a contract's trading
+// hours; contracts without trading hours get none.
+func contractCalendar(contract contracts.Spec) (*calendar.Calendar, error) {
+	if contract.TradingHours == "" {
+		return nil, nil
+	}
+	cal, err := calendar.ForContract(contract.Exchange, contract.TradingHours)
+	if err != nil {
+		return nil, fmt.Errorf("contract %s: %w", contract.Root, err)
+	}
+	return cal, nil
+}
+
+// parseCalendar resolves a --calendar flag.
+func parseCalendar(name string) (*calendar.Calendar, error) {
+	switch name {
+	case "cme":
+		return calendar.CMEEquity(), nil
+	case "none", "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown calendar %q (want cme or none)", name)
+	}
 }
 
 func applyRiskTickSize(cfg *config.StrategyConfig) {
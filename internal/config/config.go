@@ -2,20 +2,35 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 
+	"trading-algo-generator/internal/contracts"
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/execution"
 	"trading-algo-generator/internal/risk"
+	"trading-algo-generator/internal/sizing"
 	"trading-algo-generator/internal/strategy"
 )
 
 // StrategyConfig is a top-level strategy configuration.
 type StrategyConfig struct {
-	Name    string          `json:"name"`
-	Params  json.RawMessage `json:"params"`
-	Risk    risk.Settings   `json:"risk"`
-	Size    int64           `json:"size"`
-	Symbol  string          `json:"symbol"`
-	TickSize float64        `json:"tick_size"`
+	Name      string                 `json:"name"`
+	Params    json.RawMessage        `json:"params"`
+	Risk      risk.Settings          `json:"risk"`
+	Costs     execution.CostSettings `json:"costs"`
+	Intrabar  string                 `json:"intrabar"`
+	Book      execution.BookSettings `json:"book"`
+	Reconcile core.ReconcileSettings `json:"reconcile"`
+	Size      int64                  `json:"size"`
+	Sizing    sizing.Settings        `json:"sizing"`
+	Exits     core.ExitSettings      `json:"exits"`
+	Symbol    string                 `json:"symbol"`
+	TickSize  float64                `json:"tick_size"`
+	// Symbols runs the strategy on each symbol with its own state and
+	// risk limits, held together by the Account limits.
+	Symbols []string             `json:"symbols"`
+	Account risk.AccountSettings `json:"account"`
 }
 
 func LoadStrategyConfig(path string) (StrategyConfig, error) {
@@ -30,27 +45,32 @@ func LoadStrategyConfig(path string) (StrategyConfig, error) {
 	return cfg, nil
 }
 
-func BuildStrategy(cfg StrategyConfig) (strategy.Strategy, error) {
-	switch cfg.Name {
-	case "breakout":
-		var params strategy.BreakoutConfig
-		if err := json.Unmarshal(cfg.Params, &params); err != nil {
-			return nil, err
-		}
-		return &strategy.BreakoutStrategy{Config: params}, nil
-	case "mean_reversion":
-		var params strategy.MeanReversionConfig
-		if err := json.Unmarshal(cfg.Params, &params); err != nil {
-			return nil, err
-		}
-		return &strategy.MeanReversionStrategy{Config: params}, nil
-	case "delta_trend":
-		var params strategy.DeltaTrendConfig
-		if err := json.Unmarshal(cfg.Params, &params); err != nil {
-			return nil, err
-		}
-		return &strategy.DeltaTrendStrategy{Config: params}, nil
-	default:
-		return nil, os.ErrNotExist
+// LoadContracts returns the contract registry at path, or the built-in
+// defaults when path is empty.
+func LoadContracts(path string) (*contracts.Registry, error) {
+	if path == "" {
+		return contracts.DefaultRegistry(), nil
+	}
+	return contracts.LoadRegistry(path)
+}
+
+// ResolveContract looks up the configured symbol and fills in the tick size
+// from the contract spec when the config omits it.
+func ResolveContract(cfg *StrategyConfig, registry *contracts.Registry) (contracts.Spec, error) {
+	spec, err := registry.Lookup(cfg.Symbol)
+	if err != nil {
+		return spec, err
 	}
+	if cfg.TickSize == 0 {
+		cfg.TickSize = spec.TickSize
+	}
+	if cfg.TickSize != spec.TickSize {
+		return spec, fmt.Errorf("symbol %s: tick_size %g does not match contract tick size %g", cfg.Symbol, cfg.TickSize, spec.TickSize)
+	}
+	return spec, nil
+}
+
+// BuildStrategy builds the registered strategy named in the config.
+func BuildStrategy(cfg StrategyConfig) (strategy.Strategy, error) {
+	return strategy.Build(cfg.Name, cfg.Params)
 }
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"trading-algo-generator/internal/risk"
+)
+
+// PortfolioConfig runs several strategy configs side by side on one
+// account.
+type PortfolioConfig struct {
+	Strategies []PortfolioStrategy `json:"strategies"`
+	// Positions is segregated (default) or netted.
+	Positions      string               `json:"positions"`
+	StartingEquity float64              `json:"starting_equity"`
+	Account        risk.AccountSettings `json:"account"`
+}
+
+// PortfolioStrategy is a strategy config and its share of the portfolio's
+// starting equity. Name defaults to the strategy config's name.
+type PortfolioStrategy struct {
+	Name       string  `json:"name"`
+	Config     string  `json:"config"`
+	Allocation float64 `json:"allocation"`
+}
+
+// LoadPortfolioConfig reads a portfolio config. When no allocations are
+// set the starting equity is split evenly.
+func LoadPortfolioConfig(path string) (PortfolioConfig, error) {
+	var cfg PortfolioConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	if len(cfg.Strategies) == 0 {
+		return cfg, fmt.Errorf("portfolio %s lists no strategies", path)
+	}
+	var total float64
+	for i, strategy := range cfg.Strategies {
+		if strategy.Config == "" {
+			return cfg, fmt.Errorf("portfolio strategy %d: config required", i+1)
+		}
+		if strategy.Allocation < 0 {
+			return cfg, fmt.Errorf("portfolio strategy %d: negative allocation %g", i+1, strategy.Allocation)
+		}
+		total += strategy.Allocation
+	}
+	if total > 1+1e-9 {
+		return cfg, fmt.Errorf("portfolio allocations sum to %g, more than 1", total)
+	}
+	if total == 0 {
+		for i := range cfg.Strategies {
+			cfg.Strategies[i].Allocation = 1 / float64(len(cfg.Strategies))
+		}
+	}
+	return cfg, nil
+}
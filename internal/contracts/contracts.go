@@ -0,0 +1,161 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Spec describes the economics and venue of a futures contract.
+type Spec struct {
+	Root         string  `json:"root"`
+	Name         string  `json:"name"`
+	TickSize     float64 `json:"tick_size"`
+	TickValue    float64 `json:"tick_value"`
+	PointValue   float64 `json:"point_value"`
+	Currency     string  `json:"currency"`
+	Exchange     string  `json:"exchange"`
+	TradingHours string  `json:"trading_hours"`
+}
+
+// Normalize derives tick value or point value when only one is given.
+func (s Spec) Normalize() Spec {
+	if s.TickSize > 0 {
+		if s.PointValue == 0 && s.TickValue > 0 {
+			s.PointValue = s.TickValue / s.TickSize
+		}
+		if s.TickValue == 0 && s.PointValue > 0 {
+			s.TickValue = s.PointValue * s.TickSize
+		}
+	}
+	if s.Currency == "" {
+		s.Currency = "USD"
+	}
+	return s
+}
+
+// Validate checks the spec can price a trade.
+func (s Spec) Validate() error {
+	if s.Root == "" {
+		return fmt.Errorf("contract root required")
+	}
+	if s.TickSize <= 0 {
+		return fmt.Errorf("contract %s: tick size must be positive", s.Root)
+	}
+	if s.PointValue <= 0 {
+		return fmt.Errorf("contract %s: tick value or point value must be positive", s.Root)
+	}
+	return nil
+}
+
+// Value converts a price move for size contracts into account currency.
+func (s Spec) Value(move float64, size int64) float64 {
+	return move * s.PointValue * float64(size)
+}
+
+// Ticks converts a price move into whole ticks.
+func (s Spec) Ticks(move float64) int64 {
+	if s.TickSize <= 0 {
+		return 0
+	}
+	return int64(math.Round(move / s.TickSize))
+}
+
+// DefaultSpecs covers the CME equity-index futures and their micros.
+var DefaultSpecs = []Spec{
+	{Root: "ES", Name: "E-mini S&P 500", TickSize: 0.25, TickValue: 12.50, PointValue: 50, Currency: "USD", Exchange: "CME", TradingHours: "17:00-16:00 America/Chicago"},
+	{Root: "NQ", Name: "E-mini Nasdaq-100", TickSize: 0.25, TickValue: 5.00, PointValue: 20, Currency: "USD", Exchange: "CME", TradingHours: "17:00-16:00 America/Chicago"},
+	{Root: "YM", Name: "E-mini Dow", TickSize: 1, TickValue: 5.00, PointValue: 5, Currency: "USD", Exchange: "CBOT", TradingHours: "17:00-16:00 America/Chicago"},
+	{Root: "RTY", Name: "E-mini Russell 2000", TickSize: 0.1, TickValue: 5.00, PointValue: 50, Currency: "USD", Exchange: "CME", TradingHours: "17:00-16:00 America/Chicago"},
+	{Root: "MES", Name: "Micro E-mini S&P 500", TickSize: 0.25, TickValue: 1.25, PointValue: 5, Currency: "USD", Exchange: "CME", TradingHours: "17:00-16:00 America/Chicago"},
+	{Root: "MNQ", Name: "Micro E-mini Nasdaq-100", TickSize: 0.25, TickValue: 0.50, PointValue: 2, Currency: "USD", Exchange: "CME", TradingHours: "17:00-16:00 America/Chicago"},
+	{Root: "MYM", Name: "Micro E-mini Dow", TickSize: 1, TickValue: 0.50, PointValue: 0.5, Currency: "USD", Exchange: "CBOT", TradingHours: "17:00-16:00 America/Chicago"},
+	{Root: "M2K", Name: "Micro E-mini Russell 2000", TickSize: 0.1, TickValue: 0.50, PointValue: 5, Currency: "USD", Exchange: "CME", TradingHours: "17:00-16:00 America/Chicago"},
+}
+
+// Registry resolves symbols to contract specs.
+type Registry struct {
+	specs map[string]Spec
+}
+
+// NewRegistry builds a registry from specs, rejecting invalid entries.
+func NewRegistry(specs []Spec) (*Registry, error) {
+	r := &Registry{specs: make(map[string]Spec, len(specs))}
+	for _, spec := range specs {
+		if err := r.Add(spec); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// DefaultRegistry returns a registry seeded with DefaultSpecs.
+func DefaultRegistry() *Registry {
+	r, err := NewRegistry(DefaultSpecs)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// LoadRegistry reads a JSON list of specs layered over the defaults.
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("parse contracts %s: %w", path, err)
+	}
+	r := DefaultRegistry()
+	for _, spec := range specs {
+		if err := r.Add(spec); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add registers or replaces a spec by root.
+func (r *Registry) Add(spec Spec) error {
+	spec.Root = strings.ToUpper(strings.TrimSpace(spec.Root))
+	spec = spec.Normalize()
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	r.specs[spec.Root] = spec
+	return nil
+}
+
+// Lookup resolves a symbol such as "ES", "ESZ4" or "MESH25" to its spec,
+// preferring the longest matching root.
+func (r *Registry) Lookup(symbol string) (Spec, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if spec, ok := r.specs[symbol]; ok {
+		return spec, nil
+	}
+	var best Spec
+	for root, spec := range r.specs {
+		if strings.HasPrefix(symbol, root) && len(root) > len(best.Root) {
+			best = spec
+		}
+	}
+	if best.Root == "" {
+		return Spec{}, fmt.Errorf("unknown contract %q", symbol)
+	}
+	return best, nil
+}
+
+// Roots lists registered roots in sorted order.
+func (r *Registry) Roots() []string {
+	roots := make([]string, 0, len(r.specs))
+	for root := range r.specs {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots
+}
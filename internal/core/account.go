@@ -0,0 +1,72 @@
+package core
+
+import "fmt"
+
+// AccountPosition is the net position a broker reports for one symbol.
+// An empty Symbol means the account only trades one.
+type AccountPosition struct {
+	Symbol    string    `json:"symbol,omitempty"`
+	Direction Direction `json:"direction"`
+	Size      int64     `json:"size"`
+	AvgPrice  float64   `json:"avg_price"`
+}
+
+// ReconcileSettings configure reconciliation of engine state against the
+// broker: Policy is "adopt", "flatten" or "halt" (empty disables it),
+// EveryBars repeats it after the first bar (0 checks on startup only) and
+// AckBars is how many bars a check waits on an unacknowledged order
+// (0 means DefaultReconcileAckBars).
+type ReconcileSettings struct {
+	Policy    string
+	EveryBars int
+	AckBars   int
+}
+
+// DefaultReconcileAckBars is how many bars reconciliation waits for the
+// broker to acknowledge an order before reporting it.
+const DefaultReconcileAckBars = 3
+
+// ReconcilePolicy decides what the engine does when its position or
+// working orders disagree with the broker's.
+type ReconcilePolicy int
+
+const (
+	// ReconcileOff never queries the broker.
+	ReconcileOff ReconcilePolicy = iota
+	// ReconcileAdopt takes the broker's position as the engine's and
+	// cancels orders the engine did not send.
+	ReconcileAdopt
+	// ReconcileFlatten adopts the broker's position, then closes it.
+	ReconcileFlatten
+	// ReconcileHalt stops the engine with an error.
+	ReconcileHalt
+)
+
+func (p ReconcilePolicy) String() string {
+	switch p {
+	case ReconcileAdopt:
+		return "adopt"
+	case ReconcileFlatten:
+		return "flatten"
+	case ReconcileHalt:
+		return "halt"
+	default:
+		return "off"
+	}
+}
+
+// ParseReconcilePolicy maps a config value to a ReconcilePolicy.
+func ParseReconcilePolicy(value string) (ReconcilePolicy, error) {
+	switch value {
+	case "", "off":
+		return ReconcileOff, nil
+	case "adopt":
+		return ReconcileAdopt, nil
+	case "flatten":
+		return ReconcileFlatten, nil
+	case "halt":
+		return ReconcileHalt, nil
+	default:
+		return ReconcileOff, fmt.Errorf("unknown reconcile policy %q", value)
+	}
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"trading-algo-generator/internal/risk"
+	"trading-algo-generator/internal/sizing"
+)
+
+// EngineState is everything a restarted engine needs to carry on from the
+// last bar it applied: the position, orders in flight, risk counters,
+// recorded trades and the strategy's and feature generators' own state.
+type EngineState struct {
+	LastBar          time.Time
+	LastClose        float64
+	Position         Position
+	Orders           []OrderSnapshot
+	OrderSeq         int64
+	EntryOrderID     string
+	Bars             int64
+	DecayBars        int     `json:",omitempty"`
+	PendingReverse   *Signal `json:",omitempty"`
+	ReconcilePending bool
+	Risk             risk.State
+	Trades           []Trade
+	Blocked          map[string]int `json:",omitempty"`
+	RiskTriggers     map[string]int `json:",omitempty"`
+	Strategy         string
+	StrategyState    json.RawMessage `json:",omitempty"`
+	Features         map[string]json.RawMessage
+}
+
+// OrderSnapshot is a tracked order and what its fills mean. Exit is nil
+// for entries.
+type OrderSnapshot struct {
+	State           OrderState
+	StopTicks       int64
+	TargetTicks     int64
+	Exit            *ExitSnapshot
+	Lots            []LotAllocation
+	CancelRequested bool
+	SentBar         int64
+}
+
+// ExitSnapshot is the triggered exit an exit order was sent for.
+type ExitSnapshot struct {
+	Price     float64
+	Reason    string
+	OrderType OrderType
+}
+
+// LotAllocation is the part of a lot an exit order still has to close.
+type LotAllocation struct {
+	LotID string
+	Size  int64
+}
+
+// LastBar is the timestamp of the last bar OnTick applied.
+func (e *Engine) LastBar() time.Time {
+	return e.lastBar
+}
+
+// LastClose is the close of the last bar OnTick applied.
+func (e *Engine) LastClose() float64 {
+	return e.lastClose
+}
+
+// Activity counts the orders the engine has sent and the order events it
+// has applied. When it changes over a bar, so did state a remote broker
+// also holds.
+func (e *Engine) Activity() int64 {
+	return e.orderSeq + e.eventsApplied
+}
+
+// Snapshot captures the engine's state between bars.
+func (e *Engine) Snapshot() (EngineState, error) {
+	state := EngineState{
+		LastBar:          e.lastBar,
+		LastClose:        e.lastClose,
+		Position:         e.Position,
+		OrderSeq:         e.orderSeq,
+		EntryOrderID:     e.entryOrderID,
+		Bars:             e.bars,
+		DecayBars:        e.decayBars,
+		PendingReverse:   e.pendingReverse,
+		ReconcilePending: e.reconcilePending,
+		Risk:             e.Risk.State(),
+		Trades:           e.Evaluator.Trades,
+		Blocked:          e.Evaluator.Blocked,
+		RiskTriggers:     e.Evaluator.Triggers,
+		Strategy:         e.Strategy.Name(),
+	}
+	for _, tracked := range e.orders {
+		snapshot := OrderSnapshot{
+			State:           *tracked.state,
+			StopTicks:       tracked.bracket.stop,
+			TargetTicks:     tracked.bracket.target,
+			CancelRequested: tracked.cancelRequested,
+			SentBar:         tracked.sentBar,
+		}
+		if tracked.exit != nil {
+			snapshot.Exit = &ExitSnapshot{Price: tracked.exit.price, Reason: tracked.exit.reason, OrderType: tracked.exit.orderType}
+		}
+		for _, alloc := range tracked.lots {
+			snapshot.Lots = append(snapshot.Lots, LotAllocation{LotID: alloc.lotID, Size: alloc.size})
+		}
+		state.Orders = append(state.Orders, snapshot)
+	}
+	sort.Slice(state.Orders, func(i, j int) bool {
+		return state.Orders[i].State.Order.Timestamp.Before(state.Orders[j].State.Order.Timestamp) ||
+			state.Orders[i].State.Order.Timestamp.Equal(state.Orders[j].State.Order.Timestamp) && state.Orders[i].State.Order.ID < state.Orders[j].State.Order.ID
+	})
+	if s, ok := e.Strategy.(Snapshotter); ok {
+		data, err := s.Snapshot()
+		if err != nil {
+			return state, fmt.Errorf("snapshot strategy %s: %w", state.Strategy, err)
+		}
+		state.StrategyState = data
+	}
+	features, err := e.Features.Snapshot()
+	if err != nil {
+		return state, err
+	}
+	state.Features = features
+	return state, nil
+}
+
+// Restore puts a snapshotted state back into a freshly built engine. The
+// strategy must be the one the snapshot was taken from.
+func (e *Engine) Restore(state EngineState) error {
+	if name := e.Strategy.Name(); name != state.Strategy {
+		return fmt.Errorf("restore: snapshot is for strategy %s, engine runs %s", state.Strategy, name)
+	}
+	if len(state.StrategyState) > 0 {
+		s, ok := e.Strategy.(Snapshotter)
+		if !ok {
+			return fmt.Errorf("restore: strategy %s keeps no state", state.Strategy)
+		}
+		if err := s.Restore(state.StrategyState); err != nil {
+			return fmt.Errorf("restore strategy %s: %w", state.Strategy, err)
+		}
+	}
+	if err := e.Features.Restore(state.Features); err != nil {
+		return err
+	}
+	e.lastBar = state.LastBar
+	e.lastClose = state.LastClose
+	e.Position = state.Position
+	e.orderSeq = state.OrderSeq
+	e.entryOrderID = state.EntryOrderID
+	e.bars = state.Bars
+	e.decayBars = state.DecayBars
+	e.pendingReverse = state.PendingReverse
+	e.reconcilePending = state.ReconcilePending
+	e.Risk.Restore(state.Risk)
+	e.Evaluator.Trades = append([]Trade(nil), state.Trades...)
+	if e.Sizer != nil {
+		e.Sizer.Equity = sizing.EquityTracker{Start: e.Sizer.Settings.StartingEquity}
+		for _, trade := range state.Trades {
+			e.Sizer.Equity.Record(trade.PnL)
+		}
+	}
+	e.Evaluator.Blocked = map[string]int{}
+	for reason, n := range state.Blocked {
+		e.Evaluator.Blocked[reason] = n
+	}
+	e.Evaluator.Triggers = map[string]int{}
+	for rule, n := range state.RiskTriggers {
+		e.Evaluator.Triggers[rule] = n
+	}
+	e.orders = map[string]*trackedOrder{}
+	for _, snapshot := range state.Orders {
+		orderState := snapshot.State
+		tracked := &trackedOrder{
+			state:           &orderState,
+			bracket:         bracketTicks{stop: snapshot.StopTicks, target: snapshot.TargetTicks},
+			cancelRequested: snapshot.CancelRequested,
+			sentBar:         snapshot.SentBar,
+		}
+		if snapshot.Exit != nil {
+			tracked.exit = &exitFill{price: snapshot.Exit.Price, reason: snapshot.Exit.Reason, orderType: snapshot.Exit.OrderType}
+		}
+		for _, alloc := range snapshot.Lots {
+			tracked.lots = append(tracked.lots, lotAllocation{lotID: alloc.LotID, size: alloc.Size})
+		}
+		e.orders[orderState.Order.ID] = tracked
+	}
+	return nil
+}
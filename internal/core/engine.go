@@ -2,129 +2,814 @@ package core
 
 import (
 	"fmt"
+	"log"
+	"time"
 
+	"trading-algo-generator/internal/contracts"
 	"trading-algo-generator/internal/eval"
 	"trading-algo-generator/internal/execution"
 	"trading-algo-generator/internal/features"
 	"trading-algo-generator/internal/risk"
+	"trading-algo-generator/internal/sizing"
 	"trading-algo-generator/internal/strategy"
 )
 
-// Engine wires together features, strategy, risk, and execution.
+// Engine wires together features, strategy, risk, and execution. Orders go
+// to the broker asynchronously and the position only changes when the
+// broker confirms a fill.
 type Engine struct {
-	Strategy   strategy.Strategy
-	Features   features.Engine
-	Risk       *risk.Manager
-	Broker     execution.Broker
-	Evaluator  *eval.Evaluator
-	TickSize   float64
-	TradeSize  int64
-	Symbol     string
-	Position   Position
+	Strategy strategy.Strategy
+	Features features.Engine
+	Risk     *risk.Manager
+	// Account applies account-wide limits shared with the other engines of
+	// a Router or portfolio; nil when the engine trades alone.
+	Account   *risk.Account
+	Broker    execution.Broker
+	Evaluator *eval.Evaluator
+	Contract  contracts.Spec
+	Intrabar  IntrabarAssumption
+	TickSize  float64
+	TradeSize int64
+	// Sizer sizes entries that do not set a Quantity; nil trades TradeSize.
+	Sizer    *sizing.Sizer
+	Symbol   string
+	Position Position
+	// Exits are the time-based and signal-decay exit rules.
+	Exits ExitSettings
+	// ReconcilePolicy is applied when the broker's account disagrees with
+	// the engine, checked on the first bar and every ReconcileEvery bars.
+	ReconcilePolicy ReconcilePolicy
+	ReconcileEvery  int
+	// ReconcileAckBars bounds how long a check waits on unacknowledged
+	// orders; 0 means DefaultReconcileAckBars.
+	ReconcileAckBars int
+	Logger           *log.Logger
+
+	orders           map[string]*trackedOrder
+	orderSeq         int64
+	entryOrderID     string
+	bars             int64
+	reconcilePending bool
+	lastBar          time.Time
+	lastClose        float64
+	decayBars        int
+	eventsApplied    int64
+	// pendingReverse is a Reverse signal whose exit has been sent but not
+	// yet confirmed; its entry is sent once the position is flat.
+	pendingReverse *Signal
+}
+
+// trackedOrder is an order the engine sent and what its fills mean: an
+// entry opens a lot with its bracket, an exit closes the lots it was sized
+// from.
+type trackedOrder struct {
+	state           *OrderState
+	bracket         bracketTicks
+	exit            *exitFill
+	lots            []lotAllocation
+	cancelRequested bool
+	sentBar         int64
+}
+
+// bracketTicks carries a signal's bracket distances until its entry fills.
+type bracketTicks struct {
+	stop   int64
+	target int64
+}
+
+// lotAllocation is the part of a lot an exit order still has to close.
+type lotAllocation struct {
+	lotID string
+	size  int64
 }
 
+// OnTick applies one bar, then reports any risk rules it triggered.
 func (e *Engine) OnTick(tick Tick) error {
+	err := e.onTick(tick)
+	e.reportRiskTriggers()
+	return err
+}
+
+func (e *Engine) onTick(tick Tick) error {
+	e.bars++
+	e.lastBar = tick.Timestamp
+	e.lastClose = tick.Close
+	if observer, ok := e.Broker.(execution.MarketObserver); ok {
+		observer.OnTick(tick)
+	}
 	e.Risk.ResetIfNewSession(tick)
+	if e.Account != nil {
+		e.Account.ResetIfNewSession(tick.Timestamp)
+	}
+	e.Risk.Observe(tick)
+	if err := e.drainEvents(tick); err != nil {
+		return err
+	}
+	if e.reconcileDue() {
+		if err := e.Reconcile(tick); err != nil {
+			return err
+		}
+	}
 	features := e.Features.Build(tick)
 
+	if reason, due := e.Risk.FlattenDue(tick.Timestamp); due {
+		if err := e.flatten(tick, reason); err != nil {
+			return err
+		}
+	}
 	if e.Position.Open {
-		e.Risk.UpdateStops(&e.Position, tick)
-		if e.stopTriggered(tick) {
-			return e.closePosition(tick, "stop")
+		// Exits are checked against the levels in force when the bar opened;
+		// stops only ratchet on this bar after it survives.
+		if err := e.checkBrackets(tick); err != nil {
+			return err
 		}
+		e.Risk.UpdateStops(&e.Position, tick)
+	}
+	e.Risk.MarkToMarket(e.Position, tick)
+	if e.Account != nil {
+		e.Account.MarkToMarket(e.Risk, e.Position, e.pendingEntry(), tick)
 	}
 
 	signal := e.Strategy.OnTick(tick, features, e.Position)
+	if err := e.checkTimeExits(tick, features); err != nil {
+		return err
+	}
 	if signal == nil {
 		return nil
 	}
+	return e.applySignal(tick, signal)
+}
+
+// WorkingOrders returns the orders sent and not yet finished.
+func (e *Engine) WorkingOrders() []OrderState {
+	states := make([]OrderState, 0, len(e.orders))
+	for _, tracked := range e.orders {
+		states = append(states, *tracked.state)
+	}
+	return states
+}
+
+// applySignal carries out a signal's intent against the current position.
+func (e *Engine) applySignal(tick Tick, signal *Signal) error {
+	switch signal.Intent {
+	case Exit:
+		if err := e.cancelEntryOrder(tick); err != nil {
+			return err
+		}
+		return e.exitLots(tick, "", e.Position.Size, marketExit(tick, "signal"))
+	case ScaleOut:
+		return e.exitLots(tick, "", e.quantity(signal), marketExit(tick, "scale_out"))
+	case Reverse:
+		if e.Position.Open && e.Position.Direction == signal.Direction {
+			return nil
+		}
+		if err := e.cancelEntryOrder(tick); err != nil {
+			return err
+		}
+		if err := e.exitLots(tick, "", e.Position.Size, marketExit(tick, "reverse")); err != nil {
+			return err
+		}
+		pending := *signal
+		e.pendingReverse = &pending
+		return e.resumeReverse(tick)
+	case ScaleIn:
+		if e.Position.Open && e.Position.Direction != signal.Direction {
+			return nil
+		}
+		return e.enter(tick, signal)
+	default:
+		if signal.Direction == Flat {
+			return e.cancelEntryOrder(tick)
+		}
+		if e.Position.Open {
+			return nil
+		}
+		return e.enter(tick, signal)
+	}
+}
+
+// resumeReverse sends a pending reversal's entry once its exit has left the
+// position flat. If the exits end without closing it, e.g. rejected, the
+// reversal is dropped and counted as blocked.
+func (e *Engine) resumeReverse(tick Tick) error {
+	signal := e.pendingReverse
+	if signal == nil {
+		return nil
+	}
+	if e.Position.Open {
+		if e.exitPending() {
+			return nil
+		}
+		e.pendingReverse = nil
+		e.Evaluator.RecordBlocked("reverse_exit")
+		return nil
+	}
+	e.pendingReverse = nil
+	return e.enter(tick, signal)
+}
+
+// exitPending reports whether any exit order is still working.
+func (e *Engine) exitPending() bool {
+	for _, tracked := range e.orders {
+		if tracked.exit != nil && !tracked.state.Status.Terminal() {
+			return true
+		}
+	}
+	return false
+}
+
+// enter opens or adds a lot, subject to the risk manager. Entries against
+// an open opposite position are counted as blocked; reversals wait for
+// their exit in resumeReverse instead.
+func (e *Engine) enter(tick Tick, signal *Signal) error {
 	if signal.Direction == Flat {
 		return nil
 	}
-	if !e.Risk.AllowEntry() {
+	if reason := e.Risk.EntryBlock(tick.Timestamp); reason != "" {
+		e.Evaluator.RecordBlocked(reason)
 		return nil
 	}
-	if e.Position.Open {
+	if e.Position.Open && e.Position.Direction != signal.Direction {
+		e.Evaluator.RecordBlocked("opposite_position")
 		return nil
 	}
-	return e.openPosition(tick, signal)
+	size := e.entrySize(signal)
+	if size <= 0 {
+		e.Evaluator.RecordBlocked("size")
+		return nil
+	}
+	if !e.Risk.AllowSize(e.Position.Size + size) {
+		e.Evaluator.RecordBlocked("max_position")
+		return nil
+	}
+	if e.Account != nil {
+		if reason := e.Account.EntryBlock(e.Risk, e.Position.Size+size); reason != "" {
+			e.Evaluator.RecordBlocked(reason)
+			return nil
+		}
+	}
+	if err := e.sendEntry(tick, signal, size); err != nil {
+		return err
+	}
+	if e.Account != nil {
+		e.Account.Reserve(e.Risk, e.Position.Size+e.pendingEntry())
+	}
+	return nil
 }
 
-func (e *Engine) openPosition(tick Tick, signal *Signal) error {
+// sendEntry works a priced entry order or sends a market one.
+func (e *Engine) sendEntry(tick Tick, signal *Signal, size int64) error {
+	if signal.OrderType != Market {
+		return e.workEntryOrder(tick, signal, size)
+	}
+	if err := e.cancelEntryOrder(tick); err != nil {
+		return err
+	}
 	order := Order{
-		Timestamp: tick.Timestamp,
 		Direction: signal.Direction,
-		Size:      e.TradeSize,
+		Size:      size,
 		Type:      Market,
 		Price:     tick.Close,
 	}
-	fill, err := e.Broker.PlaceOrder(order)
-	if err != nil {
+	return e.submit(tick, order, &trackedOrder{bracket: bracketTicks{stop: signal.StopTicks, target: signal.TargetTicks}})
+}
+
+// pendingEntry is the unfilled size of the working entry order.
+func (e *Engine) pendingEntry() int64 {
+	if tracked, ok := e.orders[e.entryOrderID]; ok && !tracked.state.Status.Terminal() {
+		return tracked.state.Remaining()
+	}
+	return 0
+}
+
+// entrySize is the signal's Quantity, or what the sizer makes of its stop
+// distance, the current volatility and the strategy's record so far,
+// clamped to the room left under risk.MaxPositionSize.
+func (e *Engine) entrySize(signal *Signal) int64 {
+	if signal.Quantity > 0 || e.Sizer == nil {
+		return e.quantity(signal)
+	}
+	stopTicks := signal.StopTicks
+	if stopTicks <= 0 {
+		stopTicks = e.Risk.StopTicks()
+	}
+	inputs := sizing.Inputs{
+		Base:       e.TradeSize,
+		StopRisk:   e.Contract.Value(float64(stopTicks)*e.Contract.TickSize, 1),
+		Confidence: signal.Confidence,
+	}
+	if volatility, ok := e.Risk.Volatility(); ok {
+		inputs.Volatility = e.Contract.Value(volatility, 1)
+	}
+	if e.Sizer.Policy() == sizing.Kelly {
+		summary := e.Evaluator.Summary()
+		inputs.WinRate = summary.WinRate
+		inputs.Trades = summary.TotalTrades
+		if summary.AverageLoss < 0 {
+			inputs.Payoff = summary.AverageWin / -summary.AverageLoss
+		}
+	}
+	size := e.Sizer.Size(inputs)
+	if room := e.Risk.SizeRoom(e.Position.Size); room > 0 {
+		size = min(size, room)
+	}
+	return size
+}
+
+func (e *Engine) quantity(signal *Signal) int64 {
+	if signal.Quantity > 0 {
+		return signal.Quantity
+	}
+	return e.TradeSize
+}
+
+// submit assigns the order a client ID, starts tracking it and sends it,
+// then applies whatever the broker has already reported.
+func (e *Engine) submit(tick Tick, order Order, tracked *trackedOrder) error {
+	if e.orders == nil {
+		e.orders = map[string]*trackedOrder{}
+	}
+	e.orderSeq++
+	order.ID = fmt.Sprintf("ORD-%d", e.orderSeq)
+	order.Timestamp = tick.Timestamp
+	tracked.state = NewOrderState(order)
+	tracked.sentBar = e.bars
+	e.orders[order.ID] = tracked
+	if tracked.exit == nil {
+		e.entryOrderID = order.ID
+	}
+	if err := e.Broker.Submit(order); err != nil {
+		delete(e.orders, order.ID)
+		if e.entryOrderID == order.ID {
+			e.entryOrderID = ""
+		}
 		return err
 	}
-	e.Position = Position{
-		Open:       true,
-		Direction:  signal.Direction,
-		EntryTime:  tick.Timestamp,
+	return e.drainEvents(tick)
+}
+
+// drainEvents applies every order event the broker has delivered so far.
+func (e *Engine) drainEvents(tick Tick) error {
+	for {
+		select {
+		case event := <-e.Broker.Events():
+			if err := e.handleOrderEvent(tick, event); err != nil {
+				return err
+			}
+			if err := e.resumeReverse(tick); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// handleOrderEvent advances the order's state, applies its fills to the
+// position and forwards the event to the strategy when it listens for
+// them.
+func (e *Engine) handleOrderEvent(tick Tick, event OrderEvent) error {
+	e.eventsApplied++
+	if tracked, ok := e.orders[event.Order.ID]; ok {
+		if err := tracked.state.Apply(event); err != nil {
+			return err
+		}
+		if event.Fill.Size > 0 {
+			var err error
+			if tracked.exit != nil {
+				err = e.applyExitFill(tick, tracked, event.Fill)
+			} else {
+				err = e.applyEntryFill(tick, tracked, event.Fill)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if tracked.state.Status.Terminal() {
+			delete(e.orders, event.Order.ID)
+			if event.Order.ID == e.entryOrderID {
+				e.entryOrderID = ""
+			}
+		}
+	}
+	if handler, ok := e.Strategy.(strategy.OrderEventHandler); ok {
+		handler.OnOrderEvent(event)
+	}
+	return nil
+}
+
+// applyEntryFill adds a lot for each entry order, placing its bracket, and
+// averages further partial fills of the same order into that lot.
+func (e *Engine) applyEntryFill(tick Tick, tracked *trackedOrder, fill Fill) error {
+	if e.Position.Open && fill.Direction != e.Position.Direction {
+		return fmt.Errorf("entry fill %s is %s against an open %s position", fill.OrderID, fill.Direction, e.Position.Direction)
+	}
+	slippage := e.Contract.Value(fill.Slippage, fill.Size)
+	if lot, ok := e.Position.Lot(fill.OrderID); ok {
+		total := lot.Size + fill.Size
+		lot.EntryPrice = (lot.EntryPrice*float64(lot.Size) + fill.Price*float64(fill.Size)) / float64(total)
+		lot.Size = total
+		lot.Commission += fill.Commission
+		lot.Fees += fill.Fees
+		lot.Slippage += slippage
+		if (lot.StopReason == "stop" || lot.StopReason == risk.ReasonMaxLoss) && lot.MaxFavorableTicks == 0 {
+			e.Risk.PlaceBracket(e.Position.Direction, lot, tracked.bracket.stop, tracked.bracket.target)
+		}
+		e.Position.Sync()
+		return nil
+	}
+	opening := !e.Position.Open
+	lot := Lot{
+		ID:         fill.OrderID,
+		EntryTime:  fillTime(tick, fill),
+		EntryBar:   e.bars,
 		EntryPrice: fill.Price,
 		Size:       fill.Size,
-		StopPrice:  0,
+		Commission: fill.Commission,
+		Fees:       fill.Fees,
+		Slippage:   slippage,
+	}
+	// The bracket is placed off the fill; the rest of the entry bar traded
+	// before we were in, so stops first ratchet on the next bar.
+	e.Risk.PlaceBracket(fill.Direction, &lot, tracked.bracket.stop, tracked.bracket.target)
+	e.Position.Direction = fill.Direction
+	e.Position.Lots = append(e.Position.Lots, lot)
+	e.Position.Sync()
+	if opening {
+		e.Risk.DailyTrades++
+		if e.Account != nil {
+			e.Account.RecordEntry()
+		}
 	}
-	e.Risk.DailyTrades++
 	return nil
 }
 
-func (e *Engine) closePosition(tick Tick, reason string) error {
-	if !e.Position.Open {
+// workEntryOrder rests a limit, stop or stop-limit entry. A working entry in
+// the same direction and type is modified in place; anything else is
+// cancelled and replaced.
+func (e *Engine) workEntryOrder(tick Tick, signal *Signal, size int64) error {
+	if tracked, ok := e.orders[e.entryOrderID]; ok {
+		working := tracked.state.Order
+		if working.Direction == signal.Direction && working.Type == signal.OrderType {
+			if working.Price == signal.LimitPrice && working.StopPrice == signal.StopPrice {
+				return nil
+			}
+			if tracked.state.Status == StatusNew || tracked.cancelRequested {
+				// Not acknowledged yet; amend on a later bar.
+				return nil
+			}
+			if err := e.Broker.Modify(working.ID, signal.LimitPrice, signal.StopPrice, working.Size); err != nil {
+				return err
+			}
+			return e.drainEvents(tick)
+		}
+		if err := e.cancelEntryOrder(tick); err != nil {
+			return err
+		}
+	}
+	order := Order{
+		Direction:   signal.Direction,
+		Size:        size,
+		Type:        signal.OrderType,
+		Price:       signal.LimitPrice,
+		StopPrice:   signal.StopPrice,
+		TimeInForce: signal.TimeInForce,
+	}
+	return e.submit(tick, order, &trackedOrder{bracket: bracketTicks{stop: signal.StopTicks, target: signal.TargetTicks}})
+}
+
+// cancelEntryOrder asks the broker to cancel the working entry. Fills that
+// arrive before the cancel is confirmed still count.
+func (e *Engine) cancelEntryOrder(tick Tick) error {
+	tracked, ok := e.orders[e.entryOrderID]
+	if !ok || tracked.cancelRequested {
 		return nil
 	}
-	fill, err := e.Broker.ClosePosition(e.Position, tick.Close, reason)
-	if err != nil {
+	tracked.cancelRequested = true
+	if err := e.Broker.Cancel(e.entryOrderID); err != nil {
 		return err
 	}
-	pnl := e.realizedPnL(fill.Price)
+	return e.drainEvents(tick)
+}
+
+// checkBrackets exits every lot whose stop or target traded in this bar.
+// Lots filled during this bar are checked from the next one.
+func (e *Engine) checkBrackets(tick Tick) error {
+	lots := append([]Lot(nil), e.Position.Lots...)
+	for _, lot := range lots {
+		if !lot.EntryTime.Before(tick.Timestamp) {
+			continue
+		}
+		exit, ok := e.exitTriggered(lot, tick)
+		if !ok {
+			continue
+		}
+		if err := e.exitLots(tick, lot.ID, lot.Size, exit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exitLots sends one exit order for up to size contracts, sized from the
+// lot named by id, or from all lots oldest first when id is empty.
+// Contracts already being closed by a pending exit are skipped.
+func (e *Engine) exitLots(tick Tick, id string, size int64, exit exitFill) error {
+	if !e.Position.Open || size <= 0 {
+		return nil
+	}
+	var lots []lotAllocation
+	var total int64
+	for _, lot := range e.Position.Lots {
+		if total == size {
+			break
+		}
+		if id != "" && lot.ID != id {
+			continue
+		}
+		free := lot.Size - e.reserved(lot.ID)
+		if free <= 0 {
+			continue
+		}
+		if free > size-total {
+			free = size - total
+		}
+		lots = append(lots, lotAllocation{lotID: lot.ID, size: free})
+		total += free
+	}
+	if total == 0 {
+		return nil
+	}
+	if total+e.reserved("") == e.Position.Size {
+		// Any unfilled remainder of the entry must not reopen the position.
+		if err := e.cancelEntryOrder(tick); err != nil {
+			return err
+		}
+	}
+	// Targets are limit orders and fill at their price; everything else is
+	// a market exit.
+	order := Order{
+		Direction: oppositeDirection(e.Position.Direction),
+		Size:      total,
+		Type:      Market,
+		Price:     exit.price,
+	}
+	if exit.orderType == Limit {
+		order.Type = Limit
+		order.TimeInForce = IOC
+	}
+	return e.submit(tick, order, &trackedOrder{exit: &exit, lots: lots})
+}
+
+// reserved is how much of a lot (of every lot when id is empty) pending
+// exit orders have yet to close.
+func (e *Engine) reserved(id string) int64 {
+	var size int64
+	for _, tracked := range e.orders {
+		for _, alloc := range tracked.lots {
+			if id == "" || alloc.lotID == id {
+				size += alloc.size
+			}
+		}
+	}
+	return size
+}
+
+// applyExitFill closes the exit's lots, in order, by the filled size,
+// recording a trade per lot portion.
+func (e *Engine) applyExitFill(tick Tick, tracked *trackedOrder, fill Fill) error {
+	remaining := fill.Size
+	for i := range tracked.lots {
+		alloc := &tracked.lots[i]
+		if remaining == 0 {
+			break
+		}
+		lot, ok := e.Position.Lot(alloc.lotID)
+		if !ok || alloc.size == 0 {
+			continue
+		}
+		qty := alloc.size
+		if remaining < qty {
+			qty = remaining
+		}
+		if lot.Size < qty {
+			qty = lot.Size
+		}
+		closed, rest := lot.Split(qty)
+		e.recordTrade(tick, closed, fill, tracked.exit.reason)
+		*lot = rest
+		alloc.size -= qty
+		remaining -= qty
+	}
+	if tracked.state.Status.Terminal() {
+		tracked.lots = nil
+	}
+
+	direction := e.Position.Direction
+	kept := e.Position.Lots[:0]
+	for _, lot := range e.Position.Lots {
+		if lot.Size > 0 {
+			kept = append(kept, lot)
+		}
+	}
+	e.Position.Lots = kept
+	e.Position.Sync()
+	if e.Position.Open {
+		e.Position.Direction = direction
+	}
+	if remaining > 0 {
+		return fmt.Errorf("exit fill %s of %d exceeds the %d contracts it was sent for", fill.OrderID, fill.Size, fill.Size-remaining)
+	}
+	return nil
+}
+
+// recordTrade books a closed lot portion, taking its share of the exit
+// fill's costs.
+func (e *Engine) recordTrade(tick Tick, lot Lot, fill Fill, reason string) {
+	share := 1.0
+	if fill.Size > 0 {
+		share = float64(lot.Size) / float64(fill.Size)
+	}
+	gross := e.realizedPnL(lot, fill.Price)
+	commission := lot.Commission + fill.Commission*share
+	fees := lot.Fees + fill.Fees*share
+	pnl := gross - commission - fees
 	trade := Trade{
-		EntryTime: e.Position.EntryTime,
-		ExitTime:  tick.Timestamp,
-		Entry:     e.Position.EntryPrice,
-		Exit:      fill.Price,
-		Size:      e.Position.Size,
-		Direction: e.Position.Direction,
-		PnL:       pnl,
-		Reason:    reason,
+		EntryTime:  lot.EntryTime,
+		ExitTime:   fillTime(tick, fill),
+		Entry:      lot.EntryPrice,
+		Exit:       fill.Price,
+		Symbol:     e.Symbol,
+		Size:       lot.Size,
+		Direction:  e.Position.Direction,
+		GrossPnL:   gross,
+		Commission: commission,
+		Fees:       fees,
+		Slippage:   lot.Slippage + e.Contract.Value(fill.Slippage, lot.Size),
+		PnL:        pnl,
+		Reason:     reason,
+		LotID:      lot.ID,
 	}
 	e.Evaluator.Record(trade)
-	e.Risk.ApplyDailyPnL(pnl)
-	e.Position = Position{}
-	return nil
+	e.Risk.RecordTrade(trade.ExitTime, pnl)
+	if e.Account != nil {
+		e.Account.RecordTrade(trade.ExitTime, pnl)
+	}
+	if e.Sizer != nil {
+		e.Sizer.Equity.Record(pnl)
+	}
+}
+
+// fillTime is when the broker reports the fill, or the current bar when it
+// does not say.
+func fillTime(tick Tick, fill Fill) time.Time {
+	if fill.Timestamp.IsZero() {
+		return tick.Timestamp
+	}
+	return fill.Timestamp
+}
+
+// exitFill is a triggered exit: a bracket child or a strategy exit.
+type exitFill struct {
+	price     float64
+	reason    string
+	orderType OrderType
+}
+
+func marketExit(tick Tick, reason string) exitFill {
+	return exitFill{price: tick.Close, reason: reason, orderType: Market}
+}
+
+// exitTriggered checks the bar's range against a lot's stop and target. A
+// level fills at its price, or at the open when the bar gaps through it.
+// When both levels sit inside the bar the Intrabar assumption picks which
+// traded first; the other child is cancelled with the lot.
+func (e *Engine) exitTriggered(lot Lot, tick Tick) (exitFill, bool) {
+	stopPrice, stopGap, stopHit := e.stopTriggered(lot, tick)
+	targetPrice, targetGap, targetHit := e.targetTriggered(lot, tick)
+	stopReason := lot.StopReason
+	if stopReason == "" {
+		stopReason = "stop"
+	}
+	stop := exitFill{price: stopPrice, reason: stopReason, orderType: Stop}
+	target := exitFill{price: targetPrice, reason: "target", orderType: Limit}
+	switch {
+	case stopGap:
+		return stop, true
+	case targetGap:
+		return target, true
+	case stopHit && targetHit:
+		if e.Intrabar == Optimistic {
+			return target, true
+		}
+		return stop, true
+	case stopHit:
+		return stop, true
+	case targetHit:
+		return target, true
+	}
+	return exitFill{}, false
+}
+
+func (e *Engine) stopTriggered(lot Lot, tick Tick) (float64, bool, bool) {
+	stop := lot.StopPrice
+	if stop == 0 {
+		return 0, false, false
+	}
+	if e.Position.Direction == Long {
+		if tick.Open <= stop {
+			return tick.Open, true, true
+		}
+		return stop, false, tick.Low <= stop
+	}
+	if tick.Open >= stop {
+		return tick.Open, true, true
+	}
+	return stop, false, tick.High >= stop
 }
 
-func (e *Engine) stopTriggered(tick Tick) bool {
-	if !e.Position.Open || e.Position.StopPrice == 0 {
-		return false
+func (e *Engine) targetTriggered(lot Lot, tick Tick) (float64, bool, bool) {
+	target := lot.TargetPrice
+	if target == 0 {
+		return 0, false, false
 	}
 	if e.Position.Direction == Long {
-		return tick.Close <= e.Position.StopPrice
+		if tick.Open >= target {
+			return tick.Open, true, true
+		}
+		return target, false, tick.High >= target
+	}
+	if tick.Open <= target {
+		return tick.Open, true, true
 	}
-	return tick.Close >= e.Position.StopPrice
+	return target, false, tick.Low <= target
 }
 
-func (e *Engine) realizedPnL(exitPrice float64) float64 {
-	if !e.Position.Open {
-		return 0
+// Equity is the net PnL of the recorded trades plus the open lots marked at
+// the last close, net of their entry costs.
+func (e *Engine) Equity() float64 {
+	var equity float64
+	for _, trade := range e.Evaluator.Trades {
+		equity += trade.PnL
 	}
-	move := exitPrice - e.Position.EntryPrice
+	for _, lot := range e.Position.Lots {
+		equity += e.realizedPnL(lot, e.lastClose) - lot.Commission - lot.Fees
+	}
+	return equity
+}
+
+func (e *Engine) realizedPnL(lot Lot, exitPrice float64) float64 {
+	move := exitPrice - lot.EntryPrice
 	if e.Position.Direction == Short {
 		move = -move
 	}
-	return move * float64(e.Position.Size)
+	return e.Contract.Value(move, lot.Size)
 }
 
+func oppositeDirection(direction Direction) Direction {
+	switch direction {
+	case Long:
+		return Short
+	case Short:
+		return Long
+	default:
+		return Flat
+	}
+}
+
+// flatten cancels the working entry and closes the whole position at
+// market.
+func (e *Engine) flatten(tick Tick, reason string) error {
+	if err := e.cancelEntryOrder(tick); err != nil {
+		return err
+	}
+	return e.exitLots(tick, "", e.Position.Size, marketExit(tick, reason))
+}
+
+// Flush closes out at the last bar's close, e.g. at the end of the data.
 func (e *Engine) Flush(reason string) error {
-	if e.Position.Open {
-		return e.closePosition(Tick{Timestamp: e.Position.EntryTime, Close: e.Position.EntryPrice}, reason)
+	if e.lastBar.IsZero() {
+		return nil
+	}
+	err := e.flatten(Tick{Timestamp: e.lastBar, Close: e.lastClose, Symbol: e.Symbol}, reason)
+	e.reportRiskTriggers()
+	return err
+}
+
+// reportRiskTriggers logs the risk rules that fired and counts them in
+// the run summary.
+func (e *Engine) reportRiskTriggers() {
+	for _, trigger := range e.Risk.TakeTriggers() {
+		e.logf("risk: %s at %s: %s", trigger.Rule, trigger.Time.Format(time.RFC3339), trigger.Detail)
+		e.Evaluator.RecordTrigger(trigger.Rule)
+	}
+	if e.Account == nil {
+		return
+	}
+	for _, trigger := range e.Account.TakeTriggers() {
+		e.logf("risk: %s at %s: %s", trigger.Rule, trigger.Time.Format(time.RFC3339), trigger.Detail)
+		e.Evaluator.RecordTrigger(trigger.Rule)
 	}
-	return nil
 }
 
 func (e *Engine) Validate() error {
@@ -140,5 +825,11 @@ func (e *Engine) Validate() error {
 	if e.Risk == nil {
 		return fmt.Errorf("risk manager required")
 	}
+	if err := e.Contract.Validate(); err != nil {
+		return err
+	}
+	if _, ok := e.Strategy.(strategy.EntryConditionChecker); e.Exits.SignalDecayBars > 0 && !ok {
+		return fmt.Errorf("strategy %s does not support signal-decay exits", e.Strategy.Name())
+	}
 	return nil
 }
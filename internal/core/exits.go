@@ -0,0 +1,77 @@
+package core
+
+import (
+	"time"
+
+	"trading-algo-generator/internal/strategy"
+)
+
+// Exit reasons for the time-based and signal-decay rules.
+const (
+	ReasonMaxHold     = "max_hold"
+	ReasonNoProfit    = "no_profit"
+	ReasonSignalDecay = "signal_decay"
+)
+
+// checkTimeExits applies the Exits rules once the strategy has seen the
+// bar. Lots filled during this bar are checked from the next one.
+func (e *Engine) checkTimeExits(tick Tick, features FeatureSet) error {
+	if !e.Position.Open {
+		e.decayBars = 0
+		return nil
+	}
+	if e.Exits.SignalDecayBars > 0 {
+		if checker, ok := e.Strategy.(strategy.EntryConditionChecker); ok {
+			if checker.EntryValid(tick, features, e.Position.Direction) {
+				e.decayBars = 0
+			} else {
+				e.decayBars++
+			}
+			if e.decayBars >= e.Exits.SignalDecayBars {
+				e.decayBars = 0
+				return e.flatten(tick, ReasonSignalDecay)
+			}
+		}
+	}
+	lots := append([]Lot(nil), e.Position.Lots...)
+	for _, lot := range lots {
+		if lot.EntryBar >= e.bars {
+			continue
+		}
+		reason, due := e.timeExitDue(lot, tick)
+		if !due {
+			continue
+		}
+		if err := e.exitLots(tick, lot.ID, lot.Size, marketExit(tick, reason)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeExitDue checks a lot's holding period against the max-hold and
+// no-profit rules.
+func (e *Engine) timeExitDue(lot Lot, tick Tick) (string, bool) {
+	rules := e.Exits
+	held := tick.Timestamp.Sub(lot.EntryTime)
+	bars := e.bars - lot.EntryBar
+	if heldFor(held, bars, rules.MaxHoldMinutes, rules.MaxHoldBars) {
+		return ReasonMaxHold, true
+	}
+	if heldFor(held, bars, rules.NoProfitMinutes, rules.NoProfitBars) {
+		move := tick.Close - lot.EntryPrice
+		if e.Position.Direction == Short {
+			move = -move
+		}
+		required := float64(rules.MinProfitTicks) * e.Contract.TickSize
+		if move <= 0 || move < required-1e-9 {
+			return ReasonNoProfit, true
+		}
+	}
+	return "", false
+}
+
+func heldFor(held time.Duration, bars int64, minutes, maxBars int) bool {
+	return minutes > 0 && held >= time.Duration(minutes)*time.Minute ||
+		maxBars > 0 && bars >= int64(maxBars)
+}
@@ -0,0 +1,114 @@
+package core
+
+import "fmt"
+
+// OrderStatus is where an order sits in its lifecycle:
+// New -> Acked -> PartiallyFilled -> Filled, or Rejected / Cancelled.
+type OrderStatus int
+
+const (
+	// StatusNew is sent but not yet acknowledged by the broker.
+	StatusNew OrderStatus = iota
+	StatusAcked
+	StatusPartiallyFilled
+	StatusFilled
+	StatusRejected
+	// StatusCancelled covers explicit cancels, IOC remainders and expiries.
+	StatusCancelled
+)
+
+func (s OrderStatus) String() string {
+	switch s {
+	case StatusNew:
+		return "new"
+	case StatusAcked:
+		return "acked"
+	case StatusPartiallyFilled:
+		return "partially_filled"
+	case StatusFilled:
+		return "filled"
+	case StatusRejected:
+		return "rejected"
+	case StatusCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// Terminal reports whether no further events are expected.
+func (s OrderStatus) Terminal() bool {
+	return s == StatusFilled || s == StatusRejected || s == StatusCancelled
+}
+
+// OrderState tracks one order from submission through broker events.
+type OrderState struct {
+	Order    Order
+	Status   OrderStatus
+	Filled   int64
+	AvgPrice float64
+	Reason   string
+}
+
+// NewOrderState starts tracking an order that is about to be sent.
+func NewOrderState(order Order) *OrderState {
+	return &OrderState{Order: order, Status: StatusNew}
+}
+
+// Remaining is the unfilled size.
+func (s *OrderState) Remaining() int64 {
+	return s.Order.Size - s.Filled
+}
+
+// Apply advances the state with a broker event, rejecting events that are
+// not valid from the current status.
+func (s *OrderState) Apply(event OrderEvent) error {
+	if s.Status.Terminal() {
+		return fmt.Errorf("order %s: %s after %s", s.Order.ID, event.Type, s.Status)
+	}
+	switch event.Type {
+	case OrderAccepted:
+		if s.Status != StatusNew {
+			return fmt.Errorf("order %s: accepted twice", s.Order.ID)
+		}
+		s.Status = StatusAcked
+	case OrderRejected:
+		if s.Status != StatusNew {
+			return fmt.Errorf("order %s: rejected after %s", s.Order.ID, s.Status)
+		}
+		s.Status = StatusRejected
+		s.Reason = event.Reason
+	case OrderTriggered, OrderModified:
+		if s.Status == StatusNew {
+			return fmt.Errorf("order %s: %s before acknowledgement", s.Order.ID, event.Type)
+		}
+		if event.Type == OrderModified {
+			s.Order.Price = event.Order.Price
+			s.Order.StopPrice = event.Order.StopPrice
+			s.Order.Size = event.Order.Size
+		}
+	case OrderPartiallyFilled, OrderFilled:
+		if s.Status == StatusNew {
+			return fmt.Errorf("order %s: fill before acknowledgement", s.Order.ID)
+		}
+		if event.Fill.Size <= 0 || event.Fill.Size > s.Remaining() {
+			return fmt.Errorf("order %s: fill of %d with %d remaining", s.Order.ID, event.Fill.Size, s.Remaining())
+		}
+		total := s.Filled + event.Fill.Size
+		s.AvgPrice = (s.AvgPrice*float64(s.Filled) + event.Fill.Price*float64(event.Fill.Size)) / float64(total)
+		s.Filled = total
+		s.Status = StatusPartiallyFilled
+		if s.Remaining() == 0 {
+			s.Status = StatusFilled
+		}
+	case OrderCancelled, OrderExpired:
+		if s.Status == StatusNew {
+			return fmt.Errorf("order %s: %s before acknowledgement", s.Order.ID, event.Type)
+		}
+		s.Status = StatusCancelled
+		s.Reason = event.Reason
+	default:
+		return fmt.Errorf("order %s: unknown event %s", s.Order.ID, event.Type)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package core
+
+// Sync recomputes the position's aggregate fields from its lots, resetting
+// it to flat when none remain.
+func (p *Position) Sync() {
+	if len(p.Lots) == 0 {
+		*p = Position{}
+		return
+	}
+	var size int64
+	var notional float64
+	for _, lot := range p.Lots {
+		size += lot.Size
+		notional += lot.EntryPrice * float64(lot.Size)
+	}
+	p.Open = true
+	p.Size = size
+	p.EntryPrice = notional / float64(size)
+	p.EntryTime = p.Lots[0].EntryTime
+}
+
+// Lot returns the open lot with id.
+func (p *Position) Lot(id string) (*Lot, bool) {
+	for i := range p.Lots {
+		if p.Lots[i].ID == id {
+			return &p.Lots[i], true
+		}
+	}
+	return nil, false
+}
+
+// Split divides a lot into the size being closed and the remainder,
+// pro-rating entry costs between them.
+func (l Lot) Split(size int64) (Lot, Lot) {
+	if size >= l.Size {
+		return l, Lot{}
+	}
+	share := float64(size) / float64(l.Size)
+	closed := l
+	closed.Size = size
+	closed.Commission = l.Commission * share
+	closed.Fees = l.Fees * share
+	closed.Slippage = l.Slippage * share
+	rest := l
+	rest.Size = l.Size - size
+	rest.Commission = l.Commission - closed.Commission
+	rest.Fees = l.Fees - closed.Fees
+	rest.Slippage = l.Slippage - closed.Slippage
+	return closed, rest
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"trading-algo-generator/internal/execution"
+)
+
+// reconcileDue reports whether reconciliation should run on this bar: the
+// first bar, then every ReconcileEvery bars. A check that had to wait stays
+// due until it runs.
+func (e *Engine) reconcileDue() bool {
+	if e.ReconcilePolicy == ReconcileOff {
+		return false
+	}
+	if e.bars == 1 || (e.ReconcileEvery > 0 && (e.bars-1)%int64(e.ReconcileEvery) == 0) {
+		e.reconcilePending = true
+	}
+	return e.reconcilePending
+}
+
+// Reconcile compares the position and working orders with what the broker
+// reports, logs every discrepancy and applies ReconcilePolicy to
+// them. It waits for a later bar while any order is unacknowledged, since
+// the broker's view may already include it, but only for ReconcileAckBars
+// bars; an order still unacknowledged after that is itself a discrepancy.
+func (e *Engine) Reconcile(tick Tick) error {
+	reporter, ok := e.Broker.(execution.AccountReporter)
+	if !ok {
+		e.reconcilePending = false
+		e.logf("reconcile: broker cannot report account state; skipped")
+		return nil
+	}
+	ackBars := int64(e.ReconcileAckBars)
+	if ackBars <= 0 {
+		ackBars = DefaultReconcileAckBars
+	}
+	for _, tracked := range e.orders {
+		if tracked.state.Status == StatusNew && e.bars-tracked.sentBar < ackBars {
+			return nil
+		}
+	}
+	e.reconcilePending = false
+	positions, err := reporter.Positions()
+	if err != nil {
+		return fmt.Errorf("reconcile positions: %w", err)
+	}
+	openOrders, err := reporter.OpenOrders()
+	if err != nil {
+		return fmt.Errorf("reconcile orders: %w", err)
+	}
+
+	var discrepancies int
+	broker := e.brokerPosition(positions)
+	positionOff := broker.Size != e.Position.Size || (broker.Size > 0 && broker.Direction != e.Position.Direction)
+	if positionOff {
+		discrepancies++
+		e.logf("reconcile: position is %s at the broker, %s in the engine", describePosition(broker.Direction, broker.Size), describePosition(e.Position.Direction, e.Position.Size))
+	}
+	atBroker := map[string]bool{}
+	var unknown []Order
+	for _, order := range openOrders {
+		atBroker[order.ID] = true
+		if _, ok := e.orders[order.ID]; !ok {
+			unknown = append(unknown, order)
+			discrepancies++
+			e.logf("reconcile: broker has working order %s (%s %s %d) the engine did not send", order.ID, order.Direction, order.Type, order.Size)
+		}
+	}
+	var missing, unacked []string
+	for id, tracked := range e.orders {
+		switch {
+		case !atBroker[id] && tracked.state.Status == StatusNew:
+			missing = append(missing, id)
+			discrepancies++
+			e.logf("reconcile: engine order %s was never acknowledged in %d bars and is not working at the broker", id, e.bars-tracked.sentBar)
+		case !atBroker[id] && !tracked.state.Status.Terminal():
+			missing = append(missing, id)
+			discrepancies++
+			e.logf("reconcile: engine order %s is %s but not working at the broker", id, tracked.state.Status)
+		case atBroker[id] && tracked.state.Status == StatusNew:
+			unacked = append(unacked, id)
+			discrepancies++
+			e.logf("reconcile: engine order %s is working at the broker but was never acknowledged in %d bars", id, e.bars-tracked.sentBar)
+		}
+	}
+	if discrepancies == 0 {
+		return nil
+	}
+
+	if e.ReconcilePolicy == ReconcileHalt {
+		e.Risk.Halt(tick.Timestamp, "reconcile", fmt.Sprintf("%d discrepancies with the broker", discrepancies))
+		return fmt.Errorf("reconcile: %d discrepancies with the broker, halting", discrepancies)
+	}
+	e.logf("reconcile: applying %s policy", e.ReconcilePolicy)
+	for _, id := range missing {
+		delete(e.orders, id)
+		if id == e.entryOrderID {
+			e.entryOrderID = ""
+		}
+	}
+	for _, id := range unacked {
+		e.orders[id].state.Status = StatusAcked
+	}
+	for _, order := range unknown {
+		if err := e.Broker.Cancel(order.ID); err != nil {
+			return fmt.Errorf("reconcile cancel %s: %w", order.ID, err)
+		}
+	}
+	if positionOff {
+		e.adoptPosition(tick, broker)
+	}
+	if err := e.drainEvents(tick); err != nil {
+		return err
+	}
+	if e.ReconcilePolicy == ReconcileFlatten && e.Position.Open {
+		if err := e.cancelEntryOrder(tick); err != nil {
+			return err
+		}
+		return e.exitLots(tick, "", e.Position.Size, marketExit(tick, "reconcile"))
+	}
+	return nil
+}
+
+// brokerPosition nets the broker's positions in the engine's symbol. Rows
+// are netted in order like fills: rows that add to the position are
+// averaged in, rows that reduce it keep its price, and a row that crosses
+// flat starts a new price.
+func (e *Engine) brokerPosition(positions []AccountPosition) AccountPosition {
+	var qty int64
+	var price float64
+	for _, position := range positions {
+		if position.Symbol != "" && !strings.EqualFold(position.Symbol, e.Symbol) {
+			continue
+		}
+		size := position.Size
+		if position.Direction == Short {
+			size = -size
+		}
+		next := qty + size
+		switch {
+		case next == 0:
+			price = 0
+		case qty == 0 || (qty > 0) != (next > 0):
+			price = position.AvgPrice
+		case (qty > 0) == (size > 0):
+			price = (price*float64(absQty(qty)) + position.AvgPrice*float64(position.Size)) / float64(absQty(next))
+		}
+		qty = next
+	}
+	net := AccountPosition{Symbol: e.Symbol, Size: qty, Direction: Long, AvgPrice: price}
+	switch {
+	case qty < 0:
+		net.Direction = Short
+		net.Size = -qty
+	case qty == 0:
+		net.Direction = Flat
+	}
+	return net
+}
+
+func absQty(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// adoptPosition makes the position match the broker's without booking
+// trades. Lots are trimmed newest first; contracts the engine did not know
+// about open a lot at the broker's average price with a fresh bracket.
+func (e *Engine) adoptPosition(tick Tick, broker AccountPosition) {
+	if e.Position.Open && (broker.Size == 0 || broker.Direction != e.Position.Direction) {
+		e.Position = Position{}
+	}
+	direction := e.Position.Direction
+	excess := e.Position.Size - broker.Size
+	for i := len(e.Position.Lots) - 1; i >= 0 && excess > 0; i-- {
+		lot := &e.Position.Lots[i]
+		cut := min(excess, lot.Size)
+		*lot, _ = lot.Split(lot.Size - cut)
+		excess -= cut
+	}
+	kept := e.Position.Lots[:0]
+	for _, lot := range e.Position.Lots {
+		if lot.Size > 0 {
+			kept = append(kept, lot)
+		}
+	}
+	e.Position.Lots = kept
+	e.Position.Sync()
+	if e.Position.Open {
+		e.Position.Direction = direction
+	}
+	if broker.Size > e.Position.Size {
+		e.orderSeq++
+		lot := Lot{
+			ID:         fmt.Sprintf("RECON-%d", e.orderSeq),
+			EntryTime:  tick.Timestamp,
+			EntryBar:   e.bars,
+			EntryPrice: broker.AvgPrice,
+			Size:       broker.Size - e.Position.Size,
+		}
+		e.Risk.PlaceBracket(broker.Direction, &lot, 0, 0)
+		e.Position.Direction = broker.Direction
+		e.Position.Lots = append(e.Position.Lots, lot)
+		e.Position.Sync()
+	}
+}
+
+func describePosition(direction Direction, size int64) string {
+	if size == 0 {
+		return "flat"
+	}
+	return fmt.Sprintf("%s %d", direction, size)
+}
+
+func (e *Engine) logf(format string, args ...any) {
+	if e.Logger != nil {
+		e.Logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,60 @@
+package core
+
+import "testing"
+
+func TestBrokerPositionNetsMixedSides(t *testing.T) {
+	cases := []struct {
+		name string
+		rows []AccountPosition
+		want AccountPosition
+	}{
+		{
+			name: "long reduced by short keeps the long price",
+			rows: []AccountPosition{
+				{Symbol: "ES", Direction: Long, Size: 2, AvgPrice: 100},
+				{Symbol: "ES", Direction: Short, Size: 1, AvgPrice: 110},
+			},
+			want: AccountPosition{Symbol: "ES", Direction: Long, Size: 1, AvgPrice: 100},
+		},
+		{
+			name: "adding rows are averaged in",
+			rows: []AccountPosition{
+				{Symbol: "ES", Direction: Short, Size: 1, AvgPrice: 100},
+				{Symbol: "ES", Direction: Short, Size: 3, AvgPrice: 104},
+			},
+			want: AccountPosition{Symbol: "ES", Direction: Short, Size: 4, AvgPrice: 103},
+		},
+		{
+			name: "crossing flat starts a new price",
+			rows: []AccountPosition{
+				{Symbol: "ES", Direction: Long, Size: 1, AvgPrice: 100},
+				{Symbol: "ES", Direction: Short, Size: 3, AvgPrice: 110},
+			},
+			want: AccountPosition{Symbol: "ES", Direction: Short, Size: 2, AvgPrice: 110},
+		},
+		{
+			name: "offsetting rows are flat",
+			rows: []AccountPosition{
+				{Symbol: "ES", Direction: Long, Size: 2, AvgPrice: 100},
+				{Symbol: "ES", Direction: Short, Size: 2, AvgPrice: 110},
+			},
+			want: AccountPosition{Symbol: "ES", Direction: Flat},
+		},
+		{
+			name: "other symbols are ignored",
+			rows: []AccountPosition{
+				{Symbol: "NQ", Direction: Short, Size: 5, AvgPrice: 18000},
+				{Symbol: "es", Direction: Long, Size: 1, AvgPrice: 100},
+			},
+			want: AccountPosition{Symbol: "ES", Direction: Long, Size: 1, AvgPrice: 100},
+		},
+	}
+	e := &Engine{Symbol: "ES"}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := e.brokerPosition(c.rows); got != c.want {
+				t.Fatalf("brokerPosition = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
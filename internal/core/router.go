@@ -0,0 +1,130 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"trading-algo-generator/internal/eval"
+)
+
+// Router runs one Engine per symbol over a tick stream that mixes symbols,
+// so each symbol keeps its own feature windows, strategy state, position
+// and risk manager. Engines sharing a risk.Account are also held to
+// account-wide limits.
+type Router struct {
+	Engines map[string]*Engine
+	// Skipped counts ticks for symbols no engine trades.
+	Skipped map[string]int
+	routes  map[string]*Engine
+}
+
+// NewRouter keys engines by their Symbol, which must be set and distinct.
+func NewRouter(engines ...*Engine) (*Router, error) {
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("router needs at least one engine")
+	}
+	r := &Router{Engines: map[string]*Engine{}, Skipped: map[string]int{}, routes: map[string]*Engine{}}
+	for _, engine := range engines {
+		symbol := strings.ToUpper(strings.TrimSpace(engine.Symbol))
+		if symbol == "" {
+			return nil, fmt.Errorf("router engine without a symbol")
+		}
+		if _, ok := r.Engines[symbol]; ok {
+			return nil, fmt.Errorf("duplicate router symbol %s", symbol)
+		}
+		r.Engines[symbol] = engine
+	}
+	return r, nil
+}
+
+// Symbols lists the routed symbols in sorted order.
+func (r *Router) Symbols() []string {
+	symbols := make([]string, 0, len(r.Engines))
+	for symbol := range r.Engines {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// OnTick hands the tick to its symbol's engine. Ticks for other symbols are
+// counted in Skipped.
+func (r *Router) OnTick(tick Tick) error {
+	engine := r.route(tick.Symbol)
+	if engine == nil {
+		r.Skipped[tick.Symbol]++
+		return nil
+	}
+	if err := engine.OnTick(tick); err != nil {
+		return fmt.Errorf("%s: %w", engine.Symbol, err)
+	}
+	return nil
+}
+
+// route finds the engine for a tick symbol: an exact match, else the
+// longest engine symbol it starts with (ESM4 trades on ES). Ticks without
+// a symbol go to the only engine, if there is one.
+func (r *Router) route(symbol string) *Engine {
+	if engine, ok := r.routes[symbol]; ok {
+		return engine
+	}
+	key := strings.ToUpper(strings.TrimSpace(symbol))
+	engine := r.Engines[key]
+	switch {
+	case engine != nil:
+	case key == "" && len(r.Engines) == 1:
+		for _, only := range r.Engines {
+			engine = only
+		}
+	case key != "":
+		var best string
+		for root, candidate := range r.Engines {
+			if strings.HasPrefix(key, root) && len(root) > len(best) {
+				best, engine = root, candidate
+			}
+		}
+	}
+	r.routes[symbol] = engine
+	return engine
+}
+
+// Flush closes every symbol's open position at its last close.
+func (r *Router) Flush(reason string) error {
+	for _, symbol := range r.Symbols() {
+		if err := r.Engines[symbol].Flush(reason); err != nil {
+			return fmt.Errorf("%s: %w", symbol, err)
+		}
+	}
+	return nil
+}
+
+// Summary combines every symbol's trades, in exit order, and its blocked
+// signal and risk trigger counts. Currency is the first symbol's.
+func (r *Router) Summary() eval.Summary {
+	return eval.Merge(r.Evaluators()...).Summary()
+}
+
+// Evaluators lists each symbol's evaluator in symbol order.
+func (r *Router) Evaluators() []*eval.Evaluator {
+	evaluators := make([]*eval.Evaluator, 0, len(r.Engines))
+	for _, symbol := range r.Symbols() {
+		evaluators = append(evaluators, r.Engines[symbol].Evaluator)
+	}
+	return evaluators
+}
+
+// Engine is the engine that trades a tick symbol, or nil.
+func (r *Router) Engine(symbol string) *Engine {
+	return r.route(symbol)
+}
+
+// Equity is the net PnL across every symbol, open positions marked at their
+// last close.
+func (r *Router) Equity() float64 {
+	var equity float64
+	for _, engine := range r.Engines {
+		equity += engine.Equity()
+	}
+	return equity
+}
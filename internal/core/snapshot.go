@@ -0,0 +1,11 @@
+package core
+
+import "encoding/json"
+
+// Snapshotter is implemented by components whose state must survive a
+// restart, such as a strategy's rolling window. Restore accepts what
+// Snapshot returned.
+type Snapshotter interface {
+	Snapshot() (json.RawMessage, error)
+	Restore(data json.RawMessage) error
+}
@@ -1,6 +1,9 @@
 package core
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Tick is the base event used across ingestion, replay, and strategies.
 type Tick struct {
@@ -28,12 +31,59 @@ type FeatureSet struct {
 	Values    map[string]float64
 }
 
-// Signal is a directional decision from a strategy.
+// Signal is a decision from a strategy. Intent defaults to Enter, which
+// opens a position when flat. Quantity defaults to the engine's trade size.
+// OrderType defaults to Market; Limit, Stop and StopLimit entries rest at
+// LimitPrice/StopPrice until filled, cancelled or expired. A Flat Enter
+// signal cancels any working entry order.
 type Signal struct {
-	Timestamp  time.Time
-	Direction  Direction
-	Confidence float64
-	Reason     string
+	Timestamp   time.Time
+	Direction   Direction
+	Confidence  float64
+	Reason      string
+	Intent      Intent
+	Quantity    int64
+	OrderType   OrderType
+	LimitPrice  float64
+	StopPrice   float64
+	TimeInForce TimeInForce
+	// TargetTicks and StopTicks size the bracket placed around the entry,
+	// overriding the risk settings when positive.
+	TargetTicks int64
+	StopTicks   int64
+}
+
+// Intent is what a signal asks the engine to do with the position.
+type Intent int
+
+const (
+	// Enter opens a position in Direction when flat.
+	Enter Intent = iota
+	// Exit closes the whole position.
+	Exit
+	// ScaleIn adds a lot in the position's direction.
+	ScaleIn
+	// ScaleOut closes Quantity contracts, oldest lots first.
+	ScaleOut
+	// Reverse closes the position and opens one in Direction.
+	Reverse
+)
+
+func (i Intent) String() string {
+	switch i {
+	case Enter:
+		return "enter"
+	case Exit:
+		return "exit"
+	case ScaleIn:
+		return "scale_in"
+	case ScaleOut:
+		return "scale_out"
+	case Reverse:
+		return "reverse"
+	default:
+		return "unknown"
+	}
 }
 
 // Direction is the trade side.
@@ -45,14 +95,28 @@ const (
 	Short
 )
 
-// Order is a request to the broker.
+func (d Direction) String() string {
+	switch d {
+	case Long:
+		return "long"
+	case Short:
+		return "short"
+	default:
+		return "flat"
+	}
+}
+
+// Order is a request to the broker. Price is the limit price for Limit and
+// StopLimit orders; StopPrice is the trigger for Stop and StopLimit.
 type Order struct {
-	ID        string
-	Timestamp time.Time
-	Direction Direction
-	Size      int64
-	Type      OrderType
-	Price     float64
+	ID          string
+	Timestamp   time.Time
+	Direction   Direction
+	Size        int64
+	Type        OrderType
+	Price       float64
+	StopPrice   float64
+	TimeInForce TimeInForce
 }
 
 // OrderType defines execution style.
@@ -61,36 +125,205 @@ type OrderType int
 const (
 	Market OrderType = iota
 	Limit
+	Stop
+	StopLimit
 )
 
-// Fill represents an executed order.
-type Fill struct {
-	OrderID   string
+func (t OrderType) String() string {
+	switch t {
+	case Market:
+		return "market"
+	case Limit:
+		return "limit"
+	case Stop:
+		return "stop"
+	case StopLimit:
+		return "stop_limit"
+	default:
+		return "unknown"
+	}
+}
+
+// TimeInForce controls how long a working order rests.
+type TimeInForce int
+
+const (
+	// GTC rests until filled or cancelled.
+	GTC TimeInForce = iota
+	// Day expires at the end of the session it was placed in.
+	Day
+	// IOC fills against the current bar or is cancelled immediately.
+	IOC
+)
+
+// ParseTimeInForce maps a config value to a TimeInForce.
+func ParseTimeInForce(value string) (TimeInForce, error) {
+	switch value {
+	case "", "gtc", "GTC":
+		return GTC, nil
+	case "day", "DAY":
+		return Day, nil
+	case "ioc", "IOC":
+		return IOC, nil
+	default:
+		return GTC, fmt.Errorf("unknown time in force %q", value)
+	}
+}
+
+// OrderEventType classifies a change to a working order.
+type OrderEventType int
+
+const (
+	OrderAccepted OrderEventType = iota
+	OrderTriggered
+	OrderPartiallyFilled
+	OrderFilled
+	OrderModified
+	OrderCancelled
+	OrderExpired
+	OrderRejected
+)
+
+func (t OrderEventType) String() string {
+	switch t {
+	case OrderAccepted:
+		return "accepted"
+	case OrderTriggered:
+		return "triggered"
+	case OrderPartiallyFilled:
+		return "partially_filled"
+	case OrderFilled:
+		return "filled"
+	case OrderModified:
+		return "modified"
+	case OrderCancelled:
+		return "cancelled"
+	case OrderExpired:
+		return "expired"
+	case OrderRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// OrderEvent reports a change to a working order. Fill is set for
+// OrderPartiallyFilled and OrderFilled; Remaining is the unfilled size
+// after the event.
+type OrderEvent struct {
+	Type      OrderEventType
 	Timestamp time.Time
-	Price     float64
-	Size      int64
-	Direction Direction
+	Order     Order
+	Fill      Fill
+	Remaining int64
+	Reason    string
 }
 
-// Trade is a closed position record.
+// Fill represents an executed order. Slippage is the adverse price
+// adjustment already included in Price; Commission and Fees are in account
+// currency.
+type Fill struct {
+	OrderID    string
+	Timestamp  time.Time
+	Price      float64
+	Size       int64
+	Direction  Direction
+	Slippage   float64
+	Commission float64
+	Fees       float64
+}
+
+// Trade is a closed position record. GrossPnL is measured at fill prices
+// (slippage included); PnL is net of Commission and Fees. Monetary fields
+// are in account currency. Reason names the exit leg, e.g. "target",
+// "stop", "breakeven" or "trail". LotID is the lot the trade closed: the ID
+// of the entry order that opened it, or RECON-n for a lot adopted from the
+// broker.
 type Trade struct {
-	EntryTime time.Time
-	ExitTime  time.Time
-	Entry     float64
-	Exit      float64
-	Size      int64
-	Direction Direction
-	PnL       float64
-	Reason    string
+	EntryTime  time.Time
+	ExitTime   time.Time
+	Entry      float64
+	Exit       float64
+	Symbol     string
+	Size       int64
+	Direction  Direction
+	GrossPnL   float64
+	Commission float64
+	Fees       float64
+	Slippage   float64
+	PnL        float64
+	Reason     string
+	LotID      string
 }
 
-// Position tracks an open trade.
+// Position tracks an open trade as one or more lots in the same direction.
+// EntryPrice is the size-weighted average of the open lots, Size their total
+// and EntryTime the first lot's entry.
 type Position struct {
 	Open       bool
 	Direction  Direction
 	EntryTime  time.Time
 	EntryPrice float64
 	Size       int64
-	StopPrice  float64
+	Lots       []Lot
+}
+
+// Lot is one entry into a position. StopPrice and TargetPrice are its
+// one-cancels-other bracket children; StopReason names the rule that last
+// set the stop ("stop", "breakeven" or "trail"). Commission, Fees and
+// Slippage are the entry's costs in account currency. EntryBar is the
+// engine's bar count when the lot opened.
+type Lot struct {
+	ID                string
+	EntryTime         time.Time
+	EntryBar          int64
+	EntryPrice        float64
+	Size              int64
+	StopPrice         float64
+	StopReason        string
+	TargetPrice       float64
 	MaxFavorableTicks int64
+	Commission        float64
+	Fees              float64
+	Slippage          float64
+}
+
+// ExitSettings are time-based and signal-decay exit rules, each off when
+// zero. Holding periods are measured per lot, in minutes or bars.
+type ExitSettings struct {
+	// MaxHoldMinutes and MaxHoldBars close a lot once it has been open
+	// that long.
+	MaxHoldMinutes int
+	MaxHoldBars    int
+	// NoProfitMinutes and NoProfitBars close a lot that, after that long,
+	// is not at least MinProfitTicks in profit at the close.
+	NoProfitMinutes int
+	NoProfitBars    int
+	MinProfitTicks  int64
+	// SignalDecayBars closes the position once the strategy has reported
+	// its entry condition invalid for that many consecutive bars.
+	SignalDecayBars int
+}
+
+// IntrabarAssumption decides which exit fills first when one bar's range
+// spans both the stop and the target.
+type IntrabarAssumption int
+
+const (
+	// Conservative assumes the stop traded before the target.
+	Conservative IntrabarAssumption = iota
+	// Optimistic assumes the target traded before the stop.
+	Optimistic
+)
+
+// ParseIntrabar maps a config value to an IntrabarAssumption.
+func ParseIntrabar(value string) (IntrabarAssumption, error) {
+	switch value {
+	case "", "conservative":
+		return Conservative, nil
+	case "optimistic":
+		return Optimistic, nil
+	default:
+		return Conservative, fmt.Errorf("unknown intrabar assumption %q", value)
+	}
 }
@@ -2,33 +2,90 @@ package eval
 
 import (
 	"math"
+	"sort"
 
+	"trading-algo-generator/internal/contracts"
 	"trading-algo-generator/internal/core"
 )
 
-// Summary captures strategy performance statistics.
+// Summary captures strategy performance statistics. Monetary fields are in
+// Currency; TotalPnL is net of Commission and Fees, GrossPnL is before them.
 type Summary struct {
+	Currency      string
 	TotalTrades   int
 	Wins          int
 	Losses        int
 	WinRate       float64
 	Expectancy    float64
+	GrossPnL      float64
+	Commission    float64
+	Fees          float64
+	Slippage      float64
+	TotalPnL      float64
 	MaxDrawdown   float64
 	AverageWin    float64
 	AverageLoss   float64
 	EquityCurve   []float64
 	WinLossDist   map[string]int
+	ExitReasons   map[string]int
+	// BlockedSignals counts entry signals the risk manager refused, by
+	// reason.
+	BlockedSignals map[string]int
+	// RiskTriggers counts risk rules that fired (halts, cooldowns).
+	RiskTriggers map[string]int
 }
 
 // Evaluator aggregates trades into metrics.
 type Evaluator struct {
-	Trades []core.Trade
+	Contract contracts.Spec
+	Trades   []core.Trade
+	Blocked  map[string]int
+	Triggers map[string]int
 }
 
 func (e *Evaluator) Record(trade core.Trade) {
 	e.Trades = append(e.Trades, trade)
 }
 
+// RecordBlocked counts an entry signal blocked for reason.
+func (e *Evaluator) RecordBlocked(reason string) {
+	if e.Blocked == nil {
+		e.Blocked = map[string]int{}
+	}
+	e.Blocked[reason]++
+}
+
+// RecordTrigger counts a risk rule firing.
+func (e *Evaluator) RecordTrigger(rule string) {
+	if e.Triggers == nil {
+		e.Triggers = map[string]int{}
+	}
+	e.Triggers[rule]++
+}
+
+// Merge combines evaluators into one holding all their trades, in exit
+// order, and their blocked signal and trigger counts. The contract (and so
+// the currency) is the first one's.
+func Merge(evaluators ...*Evaluator) *Evaluator {
+	merged := &Evaluator{Blocked: map[string]int{}, Triggers: map[string]int{}}
+	for i, evaluator := range evaluators {
+		if i == 0 {
+			merged.Contract = evaluator.Contract
+		}
+		merged.Trades = append(merged.Trades, evaluator.Trades...)
+		for reason, n := range evaluator.Blocked {
+			merged.Blocked[reason] += n
+		}
+		for rule, n := range evaluator.Triggers {
+			merged.Triggers[rule] += n
+		}
+	}
+	sort.SliceStable(merged.Trades, func(i, j int) bool {
+		return merged.Trades[i].ExitTime.Before(merged.Trades[j].ExitTime)
+	})
+	return merged
+}
+
 func (e *Evaluator) Summary() Summary {
 	var equity float64
 	var peak float64
@@ -37,6 +94,7 @@ func (e *Evaluator) Summary() Summary {
 	var losses int
 	var winSum float64
 	var lossSum float64
+	var gross, commission, fees, slippage float64
 	dist := map[string]int{
 		"loss_small":  0,
 		"loss_medium": 0,
@@ -46,10 +104,18 @@ func (e *Evaluator) Summary() Summary {
 		"win_large":   0,
 	}
 	curve := make([]float64, 0, len(e.Trades))
+	reasons := make(map[string]int)
+	blocked := copyCounts(e.Blocked)
+	triggers := copyCounts(e.Triggers)
 
 	for _, trade := range e.Trades {
+		gross += trade.GrossPnL
+		commission += trade.Commission
+		fees += trade.Fees
+		slippage += trade.Slippage
 		equity += trade.PnL
 		curve = append(curve, equity)
+		reasons[trade.Reason]++
 		if equity > peak {
 			peak = equity
 		}
@@ -87,16 +153,26 @@ func (e *Evaluator) Summary() Summary {
 	}
 
 	return Summary{
+		Currency:    e.Contract.Normalize().Currency,
 		TotalTrades: total,
 		Wins:        wins,
 		Losses:      losses,
 		WinRate:     winRate,
 		Expectancy:  expectancy,
+		GrossPnL:    gross,
+		Commission:  commission,
+		Fees:        fees,
+		Slippage:    slippage,
+		TotalPnL:    equity,
 		MaxDrawdown: maxDD,
 		AverageWin:  avgWin,
 		AverageLoss: avgLoss,
 		EquityCurve: curve,
 		WinLossDist: dist,
+		ExitReasons: reasons,
+
+		BlockedSignals: blocked,
+		RiskTriggers:   triggers,
 	}
 }
 
@@ -107,6 +183,14 @@ func (s Summary) ProfitFactor() float64 {
 	return (s.AverageWin * float64(s.Wins)) / math.Abs(s.AverageLoss*float64(s.Losses))
 }
 
+func copyCounts(counts map[string]int) map[string]int {
+	out := make(map[string]int, len(counts))
+	for k, n := range counts {
+		out[k] = n
+	}
+	return out
+}
+
 func bucket(dist map[string]int, pnl float64, isWin bool) {
 	absPnL := math.Abs(pnl)
 	if isWin {
@@ -1,62 +1,329 @@
 package execution
 
 import (
-	"fmt"
+	"encoding/json"
+	"sort"
 	"sync"
-	"time"
 
 	"trading-algo-generator/internal/core"
 )
 
-// Broker defines order execution for the engine.
+// Broker routes orders asynchronously. Submit, Cancel and Modify only send
+// a request; its acknowledgement, fills, rejection or cancellation arrive
+// later on Events. Orders carry client-assigned IDs, which every event
+// echoes back. An error means the request itself could not be sent.
 type Broker interface {
-	PlaceOrder(order core.Order) (core.Fill, error)
-	ClosePosition(position core.Position, price float64, reason string) (core.Fill, error)
+	Submit(order core.Order) error
+	Cancel(id string) error
+	Modify(id string, price, stopPrice float64, size int64) error
+	Events() <-chan core.OrderEvent
 }
 
-// MockBroker fills orders at the provided price immediately.
+// MarketObserver is implemented by simulated brokers that price fills off
+// the current bar.
+type MarketObserver interface {
+	OnTick(tick core.Tick)
+}
+
+// AccountReporter is implemented by brokers that can report what the
+// account actually holds, so the engine can reconcile its own state.
+type AccountReporter interface {
+	Positions() ([]core.AccountPosition, error)
+	OpenOrders() ([]core.Order, error)
+}
+
+// EventQueue delivers order events in order without ever blocking the
+// publisher: events that do not fit in the channel wait in a backlog that
+// moves across whenever either side touches the queue.
+type EventQueue struct {
+	mu      sync.Mutex
+	ch      chan core.OrderEvent
+	backlog []core.OrderEvent
+}
+
+const eventQueueSize = 256
+
+func (q *EventQueue) Publish(events ...core.OrderEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.backlog = append(q.backlog, events...)
+	q.flush()
+}
+
+func (q *EventQueue) Events() <-chan core.OrderEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.flush()
+	return q.ch
+}
+
+func (q *EventQueue) flush() {
+	if q.ch == nil {
+		q.ch = make(chan core.OrderEvent, eventQueueSize)
+	}
+	for len(q.backlog) > 0 {
+		select {
+		case q.ch <- q.backlog[0]:
+			q.backlog = q.backlog[1:]
+		default:
+			return
+		}
+	}
+}
+
+// MockBroker fills market orders immediately at their price, adjusted by
+// its cost model, and rests other order types in a simulated order book.
+// Every outcome is published on Events before the call returns.
 type MockBroker struct {
+	Costs    CostModel
+	Book     OrderBook
 	mu       sync.Mutex
-	counter  int64
+	queue    EventQueue
+	ids      map[string]bool
+	market   core.Tick
+	net      NetPosition
 	LastFill *core.Fill
 }
 
-func (b *MockBroker) PlaceOrder(order core.Order) (core.Fill, error) {
+// OnTick matches working orders against the new bar.
+func (b *MockBroker) OnTick(tick core.Tick) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.market = tick
+	b.publish(b.applyCosts(b.Book.Match(tick)))
+}
+
+// Market returns the last bar seen by OnTick.
+func (b *MockBroker) Market() core.Tick {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.market
+}
+
+func (b *MockBroker) Events() <-chan core.OrderEvent {
+	return b.queue.Events()
+}
+
+func (b *MockBroker) Submit(order core.Order) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.counter++
-	fill := core.Fill{
-		OrderID:   fmt.Sprintf("MOCK-%d", b.counter),
-		Timestamp: time.Now().UTC(),
-		Price:     order.Price,
-		Size:      order.Size,
-		Direction: order.Direction,
+	if order.Timestamp.IsZero() {
+		order.Timestamp = b.market.Timestamp
+	}
+	if reason := b.checkID(order.ID); reason != "" {
+		b.publish([]core.OrderEvent{{Type: core.OrderRejected, Timestamp: b.market.Timestamp, Order: order, Remaining: order.Size, Reason: reason}})
+		return nil
+	}
+	if order.Type != core.Market {
+		b.publish(b.applyCosts(b.Book.Add(order, b.market)))
+		return nil
 	}
-	b.LastFill = &fill
-	return fill, nil
+	if order.Size <= 0 || (order.Direction != core.Long && order.Direction != core.Short) {
+		b.publish([]core.OrderEvent{{Type: core.OrderRejected, Timestamp: b.market.Timestamp, Order: order, Remaining: order.Size, Reason: "invalid order"}})
+		return nil
+	}
+	if order.Price == 0 {
+		order.Price = b.market.Close
+	}
+	fill := b.fill(order)
+	b.publish([]core.OrderEvent{
+		{Type: core.OrderAccepted, Timestamp: b.market.Timestamp, Order: order, Remaining: order.Size},
+		{Type: core.OrderFilled, Timestamp: b.market.Timestamp, Order: order, Fill: fill},
+	})
+	return nil
 }
 
-func (b *MockBroker) ClosePosition(position core.Position, price float64, reason string) (core.Fill, error) {
+func (b *MockBroker) Cancel(id string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.counter++
-	fill := core.Fill{
-		OrderID:   fmt.Sprintf("MOCK-CLOSE-%d", b.counter),
-		Timestamp: time.Now().UTC(),
-		Price:     price,
-		Size:      position.Size,
-		Direction: opposite(position.Direction),
+	event, err := b.Book.Cancel(id, b.market.Timestamp)
+	if err != nil {
+		return err
 	}
-	b.LastFill = &fill
-	return fill, nil
+	b.publish([]core.OrderEvent{event})
+	return nil
 }
 
-func opposite(direction core.Direction) core.Direction {
-	if direction == core.Long {
-		return core.Short
+func (b *MockBroker) Modify(id string, price, stopPrice float64, size int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	event, err := b.Book.Modify(id, price, stopPrice, size, b.market)
+	if err != nil {
+		return err
 	}
-	if direction == core.Short {
-		return core.Long
+	b.publish([]core.OrderEvent{event})
+	return nil
+}
+
+// WorkingOrders returns the orders resting in the book.
+func (b *MockBroker) WorkingOrders() []core.Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Book.Working()
+}
+
+// Positions reports the net position built from every fill.
+func (b *MockBroker) Positions() ([]core.AccountPosition, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if position, ok := b.net.Position(""); ok {
+		return []core.AccountPosition{position}, nil
+	}
+	return nil, nil
+}
+
+// OpenOrders reports the orders resting in the book.
+func (b *MockBroker) OpenOrders() ([]core.Order, error) {
+	return b.WorkingOrders(), nil
+}
+
+// mockState is the simulated account as saved in a checkpoint.
+type mockState struct {
+	IDs    []string
+	Market core.Tick
+	Net    NetPosition
+	Book   []restingState
+}
+
+// Snapshot saves the simulated account so a resumed run continues with
+// the same book and position.
+func (b *MockBroker) Snapshot() (json.RawMessage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := mockState{Market: b.market, Net: b.net, Book: b.Book.snapshot()}
+	for id := range b.ids {
+		state.IDs = append(state.IDs, id)
+	}
+	sort.Strings(state.IDs)
+	return json.Marshal(state)
+}
+
+func (b *MockBroker) Restore(data json.RawMessage) error {
+	var state mockState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ids = map[string]bool{}
+	for _, id := range state.IDs {
+		b.ids[id] = true
+	}
+	b.market = state.Market
+	b.net = state.Net
+	b.Book.restore(state.Book)
+	return nil
+}
+
+// checkID rejects missing and reused client order IDs.
+func (b *MockBroker) checkID(id string) string {
+	if id == "" {
+		return "order id required"
+	}
+	if b.ids == nil {
+		b.ids = map[string]bool{}
+	}
+	if b.ids[id] {
+		return "duplicate order id"
+	}
+	b.ids[id] = true
+	return ""
+}
+
+func (b *MockBroker) publish(events []core.OrderEvent) {
+	for i := range events {
+		if events[i].Fill.Size > 0 {
+			fill := events[i].Fill
+			b.LastFill = &fill
+			b.net.Apply(fill)
+		}
+	}
+	b.queue.Publish(events...)
+}
+
+// applyCosts adds fees to book fills and slippage to stop orders, which
+// fill as market orders once triggered.
+func (b *MockBroker) applyCosts(events []core.OrderEvent) []core.OrderEvent {
+	costs := b.Costs
+	if costs == nil {
+		costs = NoCosts{}
+	}
+	for i := range events {
+		fill := &events[i].Fill
+		if fill.Size == 0 {
+			continue
+		}
+		if events[i].Order.Type == core.Stop {
+			slipOrder := events[i].Order
+			slipOrder.Size = fill.Size
+			fill.Slippage = costs.Slippage(slipOrder, b.market)
+			fill.Price = slipPrice(fill.Price, fill.Slippage, fill.Direction)
+		}
+		fill.Commission, fill.Fees = costs.Fees(fill.Size)
+	}
+	return events
+}
+
+func (b *MockBroker) fill(order core.Order) core.Fill {
+	costs := b.Costs
+	if costs == nil {
+		costs = NoCosts{}
+	}
+	slippage := costs.Slippage(order, b.market)
+	commission, fees := costs.Fees(order.Size)
+	return core.Fill{
+		OrderID:    order.ID,
+		Timestamp:  b.market.Timestamp,
+		Price:      slipPrice(order.Price, slippage, order.Direction),
+		Size:       order.Size,
+		Direction:  order.Direction,
+		Slippage:   slippage,
+		Commission: commission,
+		Fees:       fees,
+	}
+}
+
+// NetPosition nets fills into a signed quantity at an average price:
+// adding fills average in, reducing fills keep the price and a fill that
+// crosses through flat opens at its own price.
+type NetPosition struct {
+	Qty      int64
+	AvgPrice float64
+}
+
+func (p *NetPosition) Apply(fill core.Fill) {
+	qty := fill.Size
+	if fill.Direction == core.Short {
+		qty = -qty
+	}
+	next := p.Qty + qty
+	switch {
+	case next == 0:
+		p.AvgPrice = 0
+	case p.Qty == 0 || (p.Qty > 0) != (next > 0):
+		p.AvgPrice = fill.Price
+	case (p.Qty > 0) == (qty > 0):
+		p.AvgPrice = (p.AvgPrice*float64(abs(p.Qty)) + fill.Price*float64(fill.Size)) / float64(abs(next))
+	}
+	p.Qty = next
+}
+
+// Position reports the net position for symbol, if not flat.
+func (p NetPosition) Position(symbol string) (core.AccountPosition, bool) {
+	if p.Qty == 0 {
+		return core.AccountPosition{}, false
+	}
+	position := core.AccountPosition{Symbol: symbol, Direction: core.Long, Size: p.Qty, AvgPrice: p.AvgPrice}
+	if p.Qty < 0 {
+		position.Direction = core.Short
+		position.Size = -p.Qty
+	}
+	return position, true
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
 	}
-	return core.Flat
+	return n
 }
@@ -0,0 +1,96 @@
+package execution
+
+import (
+	"fmt"
+	"math"
+
+	"trading-algo-generator/internal/core"
+)
+
+// CostSettings configure simulated fees and slippage. Fees are per contract
+// per side in account currency; slippage is in ticks.
+type CostSettings struct {
+	CommissionPerSide  float64
+	ExchangeFeePerSide float64
+	NFAFeePerSide      float64
+	// Slippage selects the model: "none", "fixed", "volatility" or "volume".
+	Slippage          string
+	SlippageTicks     float64
+	VolatilityFactor  float64 // fraction of the bar range for "volatility"
+	ImpactTicksPerPct float64 // extra ticks per 1% of bar volume for "volume"
+	MaxSlippageTicks  float64
+}
+
+// CostModel prices the friction of a simulated fill.
+type CostModel interface {
+	// Slippage returns the adverse price adjustment for an order given the
+	// current bar.
+	Slippage(order core.Order, market core.Tick) float64
+	// Fees returns commission and exchange/regulatory fees for one side.
+	Fees(size int64) (commission float64, fees float64)
+}
+
+// NewCostModel builds the standard cost model from settings.
+func NewCostModel(settings CostSettings, tickSize float64) (CostModel, error) {
+	switch settings.Slippage {
+	case "", "none", "fixed", "volatility", "volume":
+	default:
+		return nil, fmt.Errorf("unknown slippage model %q", settings.Slippage)
+	}
+	if settings.Slippage != "" && settings.Slippage != "none" && tickSize <= 0 {
+		return nil, fmt.Errorf("slippage model %q requires a tick size", settings.Slippage)
+	}
+	return StandardCosts{Settings: settings, TickSize: tickSize}, nil
+}
+
+// StandardCosts charges flat per-side fees and one of the built-in
+// slippage models.
+type StandardCosts struct {
+	Settings CostSettings
+	TickSize float64
+}
+
+func (c StandardCosts) Fees(size int64) (float64, float64) {
+	contracts := float64(size)
+	commission := c.Settings.CommissionPerSide * contracts
+	fees := (c.Settings.ExchangeFeePerSide + c.Settings.NFAFeePerSide) * contracts
+	return commission, fees
+}
+
+func (c StandardCosts) Slippage(order core.Order, market core.Tick) float64 {
+	var ticks float64
+	switch c.Settings.Slippage {
+	case "fixed":
+		ticks = c.Settings.SlippageTicks
+	case "volatility":
+		ticks = c.Settings.SlippageTicks
+		if c.TickSize > 0 {
+			ticks += c.Settings.VolatilityFactor * (market.High - market.Low) / c.TickSize
+		}
+	case "volume":
+		ticks = c.Settings.SlippageTicks
+		participation := float64(order.Size) / math.Max(1, float64(market.Volume)) * 100
+		ticks += c.Settings.ImpactTicksPerPct * participation
+	default:
+		return 0
+	}
+	if c.Settings.MaxSlippageTicks > 0 {
+		ticks = math.Min(ticks, c.Settings.MaxSlippageTicks)
+	}
+	return math.Round(math.Max(0, ticks)) * c.TickSize
+}
+
+// NoCosts is a frictionless cost model.
+type NoCosts struct{}
+
+func (NoCosts) Slippage(order core.Order, market core.Tick) float64 { return 0 }
+
+func (NoCosts) Fees(size int64) (float64, float64) { return 0, 0 }
+
+// slipPrice moves price against the side that is trading.
+func slipPrice(price, slippage float64, direction core.Direction) float64 {
+	if direction == core.Short {
+		return price - slippage
+	}
+	return price + slippage
+}
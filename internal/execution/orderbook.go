@@ -0,0 +1,339 @@
+package execution
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/core"
+)
+
+const priceEpsilon = 1e-9
+
+// BookSettings tune the simulated order book.
+type BookSettings struct {
+	// QueueAhead is the fraction of the volume at a price, as seen when the
+	// order is placed, assumed to be queued ahead of a new limit order.
+	// Zero means the whole displayed volume is ahead of us.
+	QueueAhead float64
+}
+
+// OrderBook rests limit, stop and stop-limit orders and matches them
+// against subsequent bars. Orders never match on the bar they were placed
+// on, except IOC orders which are tested against that bar.
+type OrderBook struct {
+	Settings BookSettings
+	// Calendar decides when DAY orders expire; nil expires them at
+	// midnight in the tick's time zone.
+	Calendar *calendar.Calendar
+	orders   []*restingOrder
+}
+
+type restingOrder struct {
+	order      core.Order
+	filled     int64
+	queueAhead float64
+	triggered  bool
+	day        time.Time
+}
+
+func (r *restingOrder) remaining() int64 { return r.order.Size - r.filled }
+
+// Add validates and rests an order, returning its acceptance (and, for IOC,
+// its immediate fill or cancellation) or a rejection.
+func (b *OrderBook) Add(order core.Order, market core.Tick) []core.OrderEvent {
+	if err := validateResting(order); err != nil {
+		return []core.OrderEvent{{Type: core.OrderRejected, Timestamp: market.Timestamp, Order: order, Remaining: order.Size, Reason: err.Error()}}
+	}
+	r := &restingOrder{order: order, day: b.sessionDay(market.Timestamp)}
+	events := []core.OrderEvent{{Type: core.OrderAccepted, Timestamp: market.Timestamp, Order: order, Remaining: order.Size}}
+	if order.TimeInForce == core.IOC {
+		if price, ok := immediate(order, market); ok {
+			return append(events, b.fill(r, market.Timestamp, price, order.Size))
+		}
+		return append(events, core.OrderEvent{Type: core.OrderCancelled, Timestamp: market.Timestamp, Order: order, Remaining: order.Size, Reason: "ioc"})
+	}
+	r.queueAhead = b.queueAt(market, order.Price)
+	b.orders = append(b.orders, r)
+	return events
+}
+
+// Cancel removes a working order.
+func (b *OrderBook) Cancel(id string, ts time.Time) (core.OrderEvent, error) {
+	for i, r := range b.orders {
+		if r.order.ID == id {
+			b.orders = append(b.orders[:i], b.orders[i+1:]...)
+			return core.OrderEvent{Type: core.OrderCancelled, Timestamp: ts, Order: r.order, Remaining: r.remaining(), Reason: "cancel"}, nil
+		}
+	}
+	return core.OrderEvent{}, fmt.Errorf("order %s not working", id)
+}
+
+// Modify changes the prices or size of a working order. A price change
+// loses queue position.
+func (b *OrderBook) Modify(id string, price, stopPrice float64, size int64, market core.Tick) (core.OrderEvent, error) {
+	for _, r := range b.orders {
+		if r.order.ID != id {
+			continue
+		}
+		if size <= r.filled {
+			return core.OrderEvent{}, fmt.Errorf("order %s: size %d not above filled %d", id, size, r.filled)
+		}
+		updated := r.order
+		updated.Price = price
+		updated.StopPrice = stopPrice
+		updated.Size = size
+		if err := validateResting(updated); err != nil {
+			return core.OrderEvent{}, err
+		}
+		if math.Abs(updated.Price-r.order.Price) > priceEpsilon {
+			r.queueAhead = b.queueAt(market, updated.Price)
+		}
+		r.order = updated
+		return core.OrderEvent{Type: core.OrderModified, Timestamp: market.Timestamp, Order: r.order, Remaining: r.remaining()}, nil
+	}
+	return core.OrderEvent{}, fmt.Errorf("order %s not working", id)
+}
+
+// Working returns the resting orders in time priority.
+func (b *OrderBook) Working() []core.Order {
+	orders := make([]core.Order, 0, len(b.orders))
+	for _, r := range b.orders {
+		orders = append(orders, r.order)
+	}
+	return orders
+}
+
+// restingState is a resting order as saved in a broker snapshot.
+type restingState struct {
+	Order      core.Order
+	Filled     int64
+	QueueAhead float64
+	Triggered  bool
+	Day        time.Time
+}
+
+func (b *OrderBook) snapshot() []restingState {
+	states := make([]restingState, 0, len(b.orders))
+	for _, r := range b.orders {
+		states = append(states, restingState{Order: r.order, Filled: r.filled, QueueAhead: r.queueAhead, Triggered: r.triggered, Day: r.day})
+	}
+	return states
+}
+
+func (b *OrderBook) restore(states []restingState) {
+	b.orders = b.orders[:0]
+	for _, s := range states {
+		b.orders = append(b.orders, &restingOrder{order: s.Order, filled: s.Filled, queueAhead: s.QueueAhead, triggered: s.Triggered, day: s.Day})
+	}
+}
+
+// Match advances every working order against a new bar.
+func (b *OrderBook) Match(tick core.Tick) []core.OrderEvent {
+	var events []core.OrderEvent
+	kept := b.orders[:0]
+	for _, r := range b.orders {
+		if r.order.TimeInForce == core.Day && !b.sessionDay(tick.Timestamp).Equal(r.day) {
+			events = append(events, core.OrderEvent{Type: core.OrderExpired, Timestamp: tick.Timestamp, Order: r.order, Remaining: r.remaining(), Reason: "day"})
+			continue
+		}
+		events = append(events, b.match(r, tick)...)
+		if r.remaining() > 0 {
+			kept = append(kept, r)
+		}
+	}
+	b.orders = kept
+	return events
+}
+
+func (b *OrderBook) match(r *restingOrder, tick core.Tick) []core.OrderEvent {
+	switch r.order.Type {
+	case core.Limit:
+		return b.matchLimit(r, tick)
+	case core.Stop:
+		if price, ok := stopTriggered(r.order, tick); ok {
+			return []core.OrderEvent{b.fill(r, tick.Timestamp, price, r.remaining())}
+		}
+	case core.StopLimit:
+		if r.triggered {
+			return b.matchLimit(r, tick)
+		}
+		price, ok := stopTriggered(r.order, tick)
+		if !ok {
+			return nil
+		}
+		r.triggered = true
+		events := []core.OrderEvent{{Type: core.OrderTriggered, Timestamp: tick.Timestamp, Order: r.order, Remaining: r.remaining()}}
+		if fillPrice, ok := marketable(core.Order{Type: core.Limit, Direction: r.order.Direction, Price: r.order.Price}, price); ok {
+			return append(events, b.fill(r, tick.Timestamp, fillPrice, r.remaining()))
+		}
+		// Unmarketable after the trigger: rest as a limit from the next bar.
+		r.queueAhead = b.queueAt(tick, r.order.Price)
+		return events
+	}
+	return nil
+}
+
+// matchLimit fills at the open on a gap through the limit, in full when
+// the bar trades through it, and from the queue when the bar only touches
+// it.
+func (b *OrderBook) matchLimit(r *restingOrder, tick core.Tick) []core.OrderEvent {
+	limit := r.order.Price
+	var gapped, through, touched bool
+	if r.order.Direction == core.Long {
+		gapped = tick.Open < limit-priceEpsilon
+		through = tick.Low < limit-priceEpsilon
+		touched = math.Abs(tick.Low-limit) <= priceEpsilon
+	} else {
+		gapped = tick.Open > limit+priceEpsilon
+		through = tick.High > limit+priceEpsilon
+		touched = math.Abs(tick.High-limit) <= priceEpsilon
+	}
+	switch {
+	case gapped:
+		return []core.OrderEvent{b.fill(r, tick.Timestamp, tick.Open, r.remaining())}
+	case through:
+		return []core.OrderEvent{b.fill(r, tick.Timestamp, limit, r.remaining())}
+	case touched:
+		traded := volumeAt(tick, limit)
+		available := traded - r.queueAhead
+		r.queueAhead = math.Max(0, r.queueAhead-traded)
+		size := int64(math.Min(float64(r.remaining()), math.Floor(available)))
+		if size > 0 {
+			return []core.OrderEvent{b.fill(r, tick.Timestamp, limit, size)}
+		}
+	}
+	return nil
+}
+
+func (b *OrderBook) fill(r *restingOrder, ts time.Time, price float64, size int64) core.OrderEvent {
+	r.filled += size
+	eventType := core.OrderPartiallyFilled
+	if r.remaining() == 0 {
+		eventType = core.OrderFilled
+	}
+	return core.OrderEvent{
+		Type:      eventType,
+		Timestamp: ts,
+		Order:     r.order,
+		Fill: core.Fill{
+			OrderID:   r.order.ID,
+			Timestamp: ts,
+			Price:     price,
+			Size:      size,
+			Direction: r.order.Direction,
+		},
+		Remaining: r.remaining(),
+	}
+}
+
+func (b *OrderBook) queueAt(market core.Tick, price float64) float64 {
+	fraction := b.Settings.QueueAhead
+	if fraction <= 0 {
+		fraction = 1
+	}
+	volume := volumeAt(market, price)
+	if volume == 0 && len(market.VolumeProfile) > 0 {
+		volume = float64(market.Volume) / float64(len(market.VolumeProfile))
+	}
+	return volume * fraction
+}
+
+func validateResting(order core.Order) error {
+	if order.Size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	if order.Direction != core.Long && order.Direction != core.Short {
+		return fmt.Errorf("direction required")
+	}
+	switch order.Type {
+	case core.Limit:
+		if order.Price <= 0 {
+			return fmt.Errorf("limit price required")
+		}
+	case core.Stop:
+		if order.StopPrice <= 0 {
+			return fmt.Errorf("stop price required")
+		}
+	case core.StopLimit:
+		if order.Price <= 0 || order.StopPrice <= 0 {
+			return fmt.Errorf("stop and limit prices required")
+		}
+	default:
+		return fmt.Errorf("%s orders do not rest", order.Type)
+	}
+	return nil
+}
+
+// stopTriggered reports whether the bar reached the stop and the price the
+// resulting market order fills at before slippage.
+func stopTriggered(order core.Order, tick core.Tick) (float64, bool) {
+	stop := order.StopPrice
+	if order.Direction == core.Long {
+		if tick.Open >= stop {
+			return tick.Open, true
+		}
+		return stop, tick.High >= stop
+	}
+	if tick.Open <= stop {
+		return tick.Open, true
+	}
+	return stop, tick.Low <= stop
+}
+
+// immediate prices an IOC order against the bar it arrives on. A limit
+// fills at the open when the bar opened through it, otherwise at the limit
+// if the bar reached it; other types are tested against the close.
+func immediate(order core.Order, market core.Tick) (float64, bool) {
+	if order.Type != core.Limit {
+		return marketable(order, market.Close)
+	}
+	if price, ok := marketable(order, market.Open); ok {
+		return price, true
+	}
+	if order.Direction == core.Long && market.Low <= order.Price+priceEpsilon {
+		return order.Price, true
+	}
+	if order.Direction == core.Short && market.High >= order.Price-priceEpsilon {
+		return order.Price, true
+	}
+	return 0, false
+}
+
+// marketable reports whether an order would trade immediately at price.
+func marketable(order core.Order, price float64) (float64, bool) {
+	switch order.Type {
+	case core.Limit, core.StopLimit:
+		if order.Direction == core.Long && price <= order.Price+priceEpsilon {
+			return price, true
+		}
+		if order.Direction == core.Short && price >= order.Price-priceEpsilon {
+			return price, true
+		}
+	case core.Stop:
+		if order.Direction == core.Long && price >= order.StopPrice {
+			return price, true
+		}
+		if order.Direction == core.Short && price <= order.StopPrice {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+func volumeAt(tick core.Tick, price float64) float64 {
+	for _, level := range tick.VolumeProfile {
+		if math.Abs(level.Price-price) <= priceEpsilon {
+			return float64(level.Volume)
+		}
+	}
+	return 0
+}
+
+func (b *OrderBook) sessionDay(ts time.Time) time.Time {
+	if b.Calendar != nil {
+		return b.Calendar.TradeDate(ts)
+	}
+	return time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+}
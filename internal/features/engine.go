@@ -1,15 +1,21 @@
 package features
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"time"
 
+	"trading-algo-generator/internal/calendar"
 	"trading-algo-generator/internal/core"
 )
 
-// Generator produces named features per tick.
+// Generator produces named features per tick. Names lists every key
+// Generate can return, though not every tick need carry all of them.
+// Generators with rolling state also implement core.Snapshotter.
 type Generator interface {
 	Name() string
+	Names() []string
 	Generate(tick core.Tick) map[string]float64
 }
 
@@ -28,6 +34,39 @@ func (e Engine) Build(tick core.Tick) core.FeatureSet {
 	return core.FeatureSet{Timestamp: tick.Timestamp, Values: values}
 }
 
+// Snapshot captures the state of every generator that keeps any, by name.
+func (e Engine) Snapshot() (map[string]json.RawMessage, error) {
+	states := map[string]json.RawMessage{}
+	for _, gen := range e.Generators {
+		if s, ok := gen.(core.Snapshotter); ok {
+			data, err := s.Snapshot()
+			if err != nil {
+				return nil, fmt.Errorf("snapshot %s: %w", gen.Name(), err)
+			}
+			states[gen.Name()] = data
+		}
+	}
+	return states, nil
+}
+
+// Restore hands each generator its snapshotted state.
+func (e Engine) Restore(states map[string]json.RawMessage) error {
+	for _, gen := range e.Generators {
+		data, ok := states[gen.Name()]
+		if !ok {
+			continue
+		}
+		s, ok := gen.(core.Snapshotter)
+		if !ok {
+			return fmt.Errorf("restore %s: generator keeps no state", gen.Name())
+		}
+		if err := s.Restore(data); err != nil {
+			return fmt.Errorf("restore %s: %w", gen.Name(), err)
+		}
+	}
+	return nil
+}
+
 // OHLCVGenerator creates price action features.
 type OHLCVGenerator struct {
 	Window int
@@ -37,6 +76,10 @@ type OHLCVGenerator struct {
 
 func (g *OHLCVGenerator) Name() string { return "ohlcv" }
 
+func (g *OHLCVGenerator) Names() []string {
+	return []string{"ohlcv_close", "ohlcv_range", "ohlcv_body", "ohlcv_sma", "ohlcv_sma_dist", "ohlcv_vol_sma"}
+}
+
 func (g *OHLCVGenerator) Generate(tick core.Tick) map[string]float64 {
 	g.prices = append(g.prices, tick.Close)
 	g.vols = append(g.vols, tick.Volume)
@@ -55,11 +98,32 @@ func (g *OHLCVGenerator) Generate(tick core.Tick) map[string]float64 {
 	}
 }
 
+// ohlcvState is the OHLCV generator's rolling window.
+type ohlcvState struct {
+	Prices  []float64
+	Volumes []int64
+}
+
+func (g *OHLCVGenerator) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(ohlcvState{Prices: g.prices, Volumes: g.vols})
+}
+
+func (g *OHLCVGenerator) Restore(data json.RawMessage) error {
+	var state ohlcvState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	g.prices, g.vols = state.Prices, state.Volumes
+	return nil
+}
+
 // DeltaGenerator creates order flow features.
 type DeltaGenerator struct{}
 
 func (g DeltaGenerator) Name() string { return "delta" }
 
+func (g DeltaGenerator) Names() []string { return []string{"delta_raw", "delta_norm"} }
+
 func (g DeltaGenerator) Generate(tick core.Tick) map[string]float64 {
 	return map[string]float64{
 		"delta_raw": float64(tick.BidAskDelta),
@@ -72,6 +136,8 @@ type VolumeProfileGenerator struct{}
 
 func (g VolumeProfileGenerator) Name() string { return "volume_profile" }
 
+func (g VolumeProfileGenerator) Names() []string { return []string{"vp_levels", "vp_skew"} }
+
 func (g VolumeProfileGenerator) Generate(tick core.Tick) map[string]float64 {
 	if len(tick.VolumeProfile) == 0 {
 		return map[string]float64{
@@ -102,35 +168,101 @@ func (g VolumeProfileGenerator) Generate(tick core.Tick) map[string]float64 {
 	}
 }
 
-// SessionGenerator encodes session markers.
-type SessionGenerator struct{}
+// SessionGenerator encodes session markers. With a Calendar the session is
+// derived from the exchange schedule rather than the tick's label, and the
+// minutes since the trade date opened and until it closes are added.
+type SessionGenerator struct {
+	Calendar *calendar.Calendar
+}
 
 func (g SessionGenerator) Name() string { return "session" }
 
+// Names includes all three session markers, though a bar carries one.
+func (g SessionGenerator) Names() []string {
+	names := []string{"session_rth", "session_eth", "session_other"}
+	if g.Calendar != nil {
+		names = append(names, "session_minutes_open", "session_minutes_to_close")
+	}
+	return names
+}
+
 func (g SessionGenerator) Generate(tick core.Tick) map[string]float64 {
-	switch tick.Session {
-	case "RTH":
-		return map[string]float64{"session_rth": 1}
-	case "ETH":
-		return map[string]float64{"session_eth": 1}
+	values := map[string]float64{}
+	session := tick.Session
+	if g.Calendar != nil {
+		session = g.Calendar.Session(tick.Timestamp)
+		day := g.Calendar.Day(g.Calendar.TradeDate(tick.Timestamp))
+		values["session_minutes_open"] = math.Max(0, tick.Timestamp.Sub(day.Open).Minutes())
+		values["session_minutes_to_close"] = math.Max(0, day.Close.Sub(tick.Timestamp).Minutes())
+	}
+	switch session {
+	case calendar.RTH:
+		values["session_rth"] = 1
+	case calendar.ETH:
+		values["session_eth"] = 1
 	default:
-		return map[string]float64{"session_other": 1}
+		values["session_other"] = 1
 	}
+	return values
 }
 
-// TimeGenerator adds cyclical time-of-day features.
-type TimeGenerator struct{}
+// TimeGenerator adds cyclical time-of-day features: tod_sin and tod_cos in
+// UTC, and tod_local_sin and tod_local_cos in the exchange's time zone when
+// a Calendar is set.
+type TimeGenerator struct {
+	Calendar *calendar.Calendar
+}
 
 func (g TimeGenerator) Name() string { return "time" }
 
+func (g TimeGenerator) Names() []string {
+	names := []string{"tod_sin", "tod_cos"}
+	if g.Calendar != nil {
+		names = append(names, "tod_local_sin", "tod_local_cos")
+	}
+	return names
+}
+
 func (g TimeGenerator) Generate(tick core.Tick) map[string]float64 {
-	t := tick.Timestamp.In(time.UTC)
+	sin, cos := timeOfDay(tick.Timestamp.UTC())
+	values := map[string]float64{
+		"tod_sin": sin,
+		"tod_cos": cos,
+	}
+	if g.Calendar != nil {
+		values["tod_local_sin"], values["tod_local_cos"] = timeOfDay(tick.Timestamp.In(g.Calendar.Location))
+	}
+	return values
+}
+
+// timeOfDay maps the clock time of t onto the unit circle.
+func timeOfDay(t time.Time) (float64, float64) {
 	seconds := float64(t.Hour()*3600 + t.Minute()*60 + t.Second())
 	angle := 2 * math.Pi * (seconds / 86400.0)
-	return map[string]float64{
-		"tod_sin": math.Sin(angle),
-		"tod_cos": math.Cos(angle),
+	return math.Sin(angle), math.Cos(angle)
+}
+
+// DefaultGenerators is the standard feature set, with session and time
+// features on the given exchange calendar (nil for tick labels and UTC).
+func DefaultGenerators(cal *calendar.Calendar) []Generator {
+	return []Generator{
+		&OHLCVGenerator{Window: 20},
+		DeltaGenerator{},
+		VolumeProfileGenerator{},
+		&VWAPGenerator{},
+		SessionGenerator{Calendar: cal},
+		TimeGenerator{Calendar: cal},
+	}
+}
+
+// Names lists every feature DefaultGenerators can produce with an exchange
+// calendar, which adds the session minutes and tod_local columns.
+func Names() []string {
+	var names []string
+	for _, gen := range DefaultGenerators(calendar.CMEEquity()) {
+		names = append(names, gen.Names()...)
 	}
+	return names
 }
 
 func averageFloat(values []float64) float64 {
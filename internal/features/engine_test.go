@@ -0,0 +1,50 @@
+package features
+
+import (
+	"testing"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/core"
+)
+
+func sampleBars() []core.Tick {
+	start := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	return []core.Tick{
+		{Timestamp: start, Open: 5000, High: 5002, Low: 4999, Close: 5001, Volume: 1200, BidAskDelta: 150, Session: calendar.RTH, Symbol: "ES"},
+		{
+			Timestamp: start.Add(time.Minute), Open: 5001, High: 5003, Low: 5000, Close: 5002.5, Volume: 900, BidAskDelta: -80, Session: calendar.RTH, Symbol: "ES",
+			VolumeProfile: []core.PriceLevel{{Price: 5000.5, Volume: 400}, {Price: 5002, Volume: 500}},
+		},
+		{Timestamp: start.Add(-10 * time.Hour), Open: 4990, High: 4991, Low: 4989, Close: 4990.5, Volume: 50, Session: calendar.ETH, Symbol: "ES"},
+		{Timestamp: start.Add(time.Minute), Open: 5001, High: 5001, Low: 5001, Close: 5001, Symbol: "ES"},
+	}
+}
+
+func TestNamesCoverGeneratedFeatures(t *testing.T) {
+	known := map[string]bool{}
+	for _, name := range Names() {
+		if known[name] {
+			t.Errorf("Names lists %q twice", name)
+		}
+		known[name] = true
+	}
+	for _, cal := range []*calendar.Calendar{nil, calendar.CMEEquity()} {
+		for _, gen := range DefaultGenerators(cal) {
+			own := map[string]bool{}
+			for _, name := range gen.Names() {
+				own[name] = true
+			}
+			for _, tick := range sampleBars() {
+				for key := range gen.Generate(tick) {
+					if !own[key] {
+						t.Errorf("%s generated %q, missing from its Names", gen.Name(), key)
+					}
+					if !known[key] {
+						t.Errorf("%s generated %q, missing from features.Names", gen.Name(), key)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"trading-algo-generator/internal/core"
+)
+
+// vwapSessionGap is the pause in ticks taken as a new session when the
+// session label does not change, as with RTH-only data.
+const vwapSessionGap = time.Hour
+
+// VWAP is a volume-weighted average price anchored to the start of the
+// current session, with the volume-weighted standard deviation of price
+// around it. A session starts when Tick.Session changes or after more than
+// an hour without ticks. Each bar's volume is priced at its volume profile
+// levels when it has one and at its typical price otherwise.
+type VWAP struct {
+	Session string
+	Start   time.Time
+	Last    time.Time
+	// Bars counts the session's bars so far.
+	Bars   int
+	Volume float64
+	// PV and PV2 are the sums of price times volume and price squared
+	// times volume.
+	PV  float64
+	PV2 float64
+}
+
+// Add folds a bar into the VWAP, first re-anchoring it on a new session.
+func (v *VWAP) Add(tick core.Tick) {
+	if v.Start.IsZero() || !strings.EqualFold(tick.Session, v.Session) || tick.Timestamp.Sub(v.Last) > vwapSessionGap {
+		*v = VWAP{Session: tick.Session, Start: tick.Timestamp}
+	}
+	v.Last = tick.Timestamp
+	v.Bars++
+	if len(tick.VolumeProfile) > 0 {
+		for _, level := range tick.VolumeProfile {
+			v.add(level.Price, float64(level.Volume))
+		}
+		return
+	}
+	v.add((tick.High+tick.Low+tick.Close)/3, float64(tick.Volume))
+}
+
+func (v *VWAP) add(price, volume float64) {
+	v.Volume += volume
+	v.PV += price * volume
+	v.PV2 += price * price * volume
+}
+
+// Value is the session's VWAP, or NaN before it has traded any volume.
+func (v *VWAP) Value() float64 {
+	if v.Volume <= 0 {
+		return math.NaN()
+	}
+	return v.PV / v.Volume
+}
+
+// StdDev is the volume-weighted standard deviation of price around the
+// VWAP.
+func (v *VWAP) StdDev() float64 {
+	if v.Volume <= 0 {
+		return 0
+	}
+	mean := v.Value()
+	return math.Sqrt(math.Max(0, v.PV2/v.Volume-mean*mean))
+}
+
+// VWAPGenerator adds the session VWAP, its standard deviation, the close's
+// distance from it in deviations, bands at 1, 2 and 3 deviations and the
+// number of bars since the session's anchor.
+// Before the session has traded volume the VWAP is the close.
+type VWAPGenerator struct {
+	vwap VWAP
+}
+
+func (g *VWAPGenerator) Name() string { return "vwap" }
+
+func (g *VWAPGenerator) Names() []string {
+	names := []string{"vwap", "vwap_sd", "vwap_z", "vwap_bars"}
+	for k := 1; k <= 3; k++ {
+		names = append(names, fmt.Sprintf("vwap_upper_%d", k), fmt.Sprintf("vwap_lower_%d", k))
+	}
+	return names
+}
+
+func (g *VWAPGenerator) Generate(tick core.Tick) map[string]float64 {
+	g.vwap.Add(tick)
+	vwap, sd := g.vwap.Value(), g.vwap.StdDev()
+	if math.IsNaN(vwap) {
+		vwap = tick.Close
+	}
+	values := map[string]float64{
+		"vwap":      vwap,
+		"vwap_sd":   sd,
+		"vwap_z":    0,
+		"vwap_bars": float64(g.vwap.Bars),
+	}
+	if sd > 0 {
+		values["vwap_z"] = (tick.Close - vwap) / sd
+	}
+	for k := 1; k <= 3; k++ {
+		values[fmt.Sprintf("vwap_upper_%d", k)] = vwap + float64(k)*sd
+		values[fmt.Sprintf("vwap_lower_%d", k)] = vwap - float64(k)*sd
+	}
+	return values
+}
+
+func (g *VWAPGenerator) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(g.vwap)
+}
+
+func (g *VWAPGenerator) Restore(data json.RawMessage) error {
+	return json.Unmarshal(data, &g.vwap)
+}
@@ -0,0 +1,485 @@
+package fix
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/execution"
+)
+
+// Acceptor is an in-process FIX 4.4 counterparty standing in for a broker.
+// Each session's orders run through its own simulated account
+// (execution.MockBroker) and are answered with ExecutionReports; market
+// data is fed in with OnTick.
+type Acceptor struct {
+	Settings SessionSettings
+	Costs    execution.CostModel
+	Book     execution.BookSettings
+	Calendar *calendar.Calendar
+	// Store persists the acceptor's sequence numbers; nil keeps them in
+	// memory per session.
+	Store  Store
+	Logger *log.Logger
+
+	mu       sync.Mutex
+	sessions []*acceptorSession
+	listener net.Listener
+}
+
+// acceptorSession is one logged-on counterparty and its account.
+type acceptorSession struct {
+	session *Session
+	account *execution.MockBroker
+
+	mu      sync.Mutex
+	roots   map[string]string
+	current map[string]string
+	symbols map[string]string
+	fills   map[string]*cumFill
+	execSeq int64
+	posSeq  int64
+	symbol  string
+}
+
+type cumFill struct {
+	qty int64
+	avg float64
+}
+
+// Serve accepts sessions on listener until Close is called.
+func (a *Acceptor) Serve(listener net.Listener) error {
+	a.mu.Lock()
+	a.listener = listener
+	a.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if err := a.ServeConn(conn); err != nil {
+			a.logf("session from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+		}
+	}
+}
+
+// ServeConn runs a session on an established connection. It returns once
+// the session is started; the initiator's Logon completes it.
+func (a *Acceptor) ServeConn(conn net.Conn) error {
+	as := &acceptorSession{
+		account: &execution.MockBroker{Costs: a.Costs, Book: execution.OrderBook{Settings: a.Book, Calendar: a.Calendar}},
+		roots:   map[string]string{},
+		current: map[string]string{},
+		symbols: map[string]string{},
+		fills:   map[string]*cumFill{},
+	}
+	store := a.Store
+	if store == nil {
+		store = &MemoryStore{}
+	}
+	as.session = newSession(a.Settings, store, a.Logger, as.onApp)
+	if err := as.session.start(conn, false); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.sessions = append(a.sessions, as)
+	a.mu.Unlock()
+	go func() {
+		<-as.session.Done()
+		a.remove(as)
+	}()
+	return nil
+}
+
+// OnTick matches every session's working orders against a new bar.
+func (a *Acceptor) OnTick(tick core.Tick) {
+	a.mu.Lock()
+	sessions := append([]*acceptorSession(nil), a.sessions...)
+	a.mu.Unlock()
+	for _, as := range sessions {
+		as.mu.Lock()
+		as.account.OnTick(tick)
+		as.reportEvents("", "")
+		as.mu.Unlock()
+	}
+}
+
+func (a *Acceptor) Close() error {
+	a.mu.Lock()
+	listener := a.listener
+	sessions := append([]*acceptorSession(nil), a.sessions...)
+	a.mu.Unlock()
+	for _, as := range sessions {
+		as.session.Logout("acceptor closing", time.Second)
+	}
+	if listener != nil {
+		return listener.Close()
+	}
+	return nil
+}
+
+func (a *Acceptor) remove(target *acceptorSession) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, as := range a.sessions {
+		if as == target {
+			a.sessions = append(a.sessions[:i], a.sessions[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *Acceptor) logf(format string, args ...any) {
+	if a.Logger != nil {
+		a.Logger.Printf(format, args...)
+	}
+}
+
+func (as *acceptorSession) onApp(msg *Message) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	switch msg.Type() {
+	case MsgNewOrderSingle:
+		as.newOrder(msg)
+	case MsgOrderCancelRequest:
+		as.cancel(msg)
+	case MsgOrderCancelReplaceRequest:
+		as.replace(msg)
+	case MsgRequestForPositions:
+		as.positions(msg)
+	case MsgOrderMassStatusRequest:
+		as.massStatus(msg)
+	default:
+		seq, _ := msg.Get(TagMsgSeqNum)
+		as.session.send(NewMessage(MsgReject).Set(TagRefSeqNum, seq).Set(TagText, "unsupported message type "+msg.Type()))
+	}
+}
+
+func (as *acceptorSession) newOrder(msg *Message) {
+	order, err := parseOrder(msg)
+	clOrdID, _ := msg.Get(TagClOrdID)
+	order.ID = clOrdID
+	symbol, _ := msg.Get(TagSymbol)
+	as.symbols[clOrdID] = symbol
+	as.symbol = symbol
+	if err == nil && clOrdID == "" {
+		err = fmt.Errorf("ClOrdID required")
+	}
+	if err == nil && as.roots[clOrdID] != "" {
+		err = fmt.Errorf("duplicate ClOrdID")
+	}
+	market := as.account.Market()
+	if err == nil && order.Type == core.Market {
+		// Market orders fill at the acceptor's own last price.
+		if market.Timestamp.IsZero() {
+			err = fmt.Errorf("no market data")
+		}
+		order.Price = market.Close
+	}
+	if err != nil {
+		as.report(core.OrderEvent{Type: core.OrderRejected, Timestamp: market.Timestamp, Order: order, Remaining: order.Size, Reason: err.Error()}, clOrdID, "")
+		return
+	}
+	as.roots[clOrdID] = clOrdID
+	as.current[clOrdID] = clOrdID
+	if err := as.account.Submit(order); err != nil {
+		as.report(core.OrderEvent{Type: core.OrderRejected, Timestamp: market.Timestamp, Order: order, Remaining: order.Size, Reason: err.Error()}, clOrdID, "")
+		return
+	}
+	as.reportEvents("", "")
+}
+
+func (as *acceptorSession) cancel(msg *Message) {
+	clOrdID, _ := msg.Get(TagClOrdID)
+	orig, _ := msg.Get(TagOrigClOrdID)
+	root, ok := as.roots[orig]
+	if !ok {
+		as.cancelReject(clOrdID, orig, "1", "unknown order")
+		return
+	}
+	if err := as.account.Cancel(root); err != nil {
+		as.cancelReject(clOrdID, orig, "1", err.Error())
+		return
+	}
+	as.roots[clOrdID] = root
+	as.reportEvents(clOrdID, orig)
+}
+
+func (as *acceptorSession) replace(msg *Message) {
+	clOrdID, _ := msg.Get(TagClOrdID)
+	orig, _ := msg.Get(TagOrigClOrdID)
+	root, ok := as.roots[orig]
+	if !ok {
+		as.cancelReject(clOrdID, orig, "2", "unknown order")
+		return
+	}
+	order, err := parseOrder(msg)
+	if err == nil {
+		err = as.account.Modify(root, order.Price, order.StopPrice, order.Size)
+	}
+	if err != nil {
+		as.cancelReject(clOrdID, orig, "2", err.Error())
+		return
+	}
+	as.roots[clOrdID] = root
+	as.current[root] = clOrdID
+	as.reportEvents(clOrdID, orig)
+}
+
+// positions answers a RequestForPositions with an ack and one
+// PositionReport per open position.
+func (as *acceptorSession) positions(msg *Message) {
+	reqID, _ := msg.Get(TagPosReqID)
+	positions, _ := as.account.Positions()
+	result := "0"
+	if len(positions) == 0 {
+		result = "2"
+	}
+	date := as.account.Market().Timestamp.UTC().Format(dateFormat)
+	as.session.send(NewMessage(MsgRequestForPositionsAck).
+		Set(TagPosMaintRptID, reqID).
+		Set(TagPosReqID, reqID).
+		SetInt(TagTotalNumPosReports, int64(len(positions))).
+		Set(TagPosReqResult, result).
+		Set(TagPosReqStatus, "0"))
+	for _, position := range positions {
+		as.posSeq++
+		long, short := position.Size, int64(0)
+		if position.Direction == core.Short {
+			long, short = 0, position.Size
+		}
+		as.session.send(NewMessage(MsgPositionReport).
+			Set(TagPosMaintRptID, fmt.Sprintf("POS-%d", as.posSeq)).
+			Set(TagPosReqID, reqID).
+			Set(TagPosReqType, "0").
+			SetInt(TagTotalNumPosReports, int64(len(positions))).
+			Set(TagPosReqResult, "0").
+			Set(TagClearingBusinessDate, date).
+			Set(TagSymbol, as.symbol).
+			SetFloat(TagSettlPrice, position.AvgPrice).
+			Set(TagNoPositions, "1").
+			Add(TagPosType, "TQ").
+			Add(TagLongQty, fmt.Sprint(long)).
+			Add(TagShortQty, fmt.Sprint(short)))
+	}
+}
+
+// massStatus answers an OrderMassStatusRequest with an order status
+// ExecutionReport per working order.
+func (as *acceptorSession) massStatus(msg *Message) {
+	reqID, _ := msg.Get(TagMassStatusReqID)
+	orders, _ := as.account.OpenOrders()
+	for n, order := range orders {
+		as.execSeq++
+		cum := as.fills[order.ID]
+		if cum == nil {
+			cum = &cumFill{}
+		}
+		status := "0"
+		if cum.qty > 0 {
+			status = "1"
+		}
+		report := as.orderReport(order, as.current[order.ID], cum).
+			Set(TagExecType, "I").
+			Set(TagOrdStatus, status).
+			SetInt(TagLeavesQty, order.Size-cum.qty).
+			SetTime(TagTransactTime, as.account.Market().Timestamp).
+			Set(TagMassStatusReqID, reqID).
+			SetInt(TagTotNumReports, int64(len(orders)))
+		if n == len(orders)-1 {
+			report.Set(TagLastRptRequested, "Y")
+		}
+		as.session.send(report)
+	}
+}
+
+func (as *acceptorSession) cancelReject(clOrdID, orig, responseTo, text string) {
+	as.session.send(NewMessage(MsgOrderCancelReject).
+		Set(TagOrderID, orig).
+		Set(TagClOrdID, clOrdID).
+		Set(TagOrigClOrdID, orig).
+		Set(TagOrdStatus, "8").
+		Set(TagCxlRejResponseTo, responseTo).
+		Set(TagText, text))
+}
+
+// reportEvents sends an ExecutionReport for every event the account has
+// published. Events answering a cancel or replace carry its ClOrdIDs.
+func (as *acceptorSession) reportEvents(clOrdID, orig string) {
+	for {
+		select {
+		case event := <-as.account.Events():
+			id, origID := as.current[event.Order.ID], ""
+			if clOrdID != "" && as.roots[clOrdID] == event.Order.ID {
+				id, origID = clOrdID, orig
+			}
+			as.report(event, id, origID)
+		default:
+			return
+		}
+	}
+}
+
+func (as *acceptorSession) report(event core.OrderEvent, clOrdID, orig string) {
+	as.execSeq++
+	root := event.Order.ID
+	cum := as.fills[root]
+	if cum == nil {
+		cum = &cumFill{}
+		as.fills[root] = cum
+	}
+	if event.Fill.Size > 0 {
+		total := cum.qty + event.Fill.Size
+		cum.avg = (cum.avg*float64(cum.qty) + event.Fill.Price*float64(event.Fill.Size)) / float64(total)
+		cum.qty = total
+	}
+	msg := as.orderReport(event.Order, clOrdID, cum).
+		Set(TagExecType, execType(event.Type)).
+		Set(TagOrdStatus, ordStatus(event.Type, cum.qty)).
+		SetInt(TagLeavesQty, event.Remaining).
+		SetTime(TagTransactTime, event.Timestamp)
+	if orig != "" {
+		msg.Set(TagOrigClOrdID, orig)
+	}
+	if event.Reason != "" {
+		msg.Set(TagText, event.Reason)
+	}
+	if event.Fill.Size > 0 {
+		msg.SetInt(TagLastQty, event.Fill.Size).
+			SetFloat(TagLastPx, event.Fill.Price).
+			SetFloat(TagCommission, event.Fill.Commission).
+			Set(TagCommType, "3")
+		if event.Fill.Fees > 0 {
+			// One exchange-fee entry in the MiscFees group.
+			msg.Add(TagNoMiscFees, "1").
+				Add(TagMiscFeeAmt, fmt.Sprint(event.Fill.Fees)).
+				Add(TagMiscFeeType, "4")
+		}
+	}
+	as.session.send(msg)
+}
+
+// orderReport starts an ExecutionReport with the order's identity, terms
+// and cumulative fills.
+func (as *acceptorSession) orderReport(order core.Order, clOrdID string, cum *cumFill) *Message {
+	if clOrdID == "" {
+		clOrdID = order.ID
+	}
+	msg := NewMessage(MsgExecutionReport).
+		Set(TagOrderID, order.ID).
+		Set(TagClOrdID, clOrdID).
+		Set(TagExecID, fmt.Sprintf("EXEC-%d", as.execSeq)).
+		Set(TagSymbol, as.symbols[order.ID]).
+		Set(TagSide, side(order.Direction)).
+		SetInt(TagOrderQty, order.Size).
+		Set(TagOrdType, ordType(order.Type)).
+		Set(TagTimeInForce, timeInForce(order.TimeInForce)).
+		SetInt(TagCumQty, cum.qty).
+		SetFloat(TagAvgPx, cum.avg)
+	if order.Type == core.Limit || order.Type == core.StopLimit {
+		msg.SetFloat(TagPrice, order.Price)
+	}
+	if order.Type == core.Stop || order.Type == core.StopLimit {
+		msg.SetFloat(TagStopPx, order.StopPrice)
+	}
+	return msg
+}
+
+// parseOrder reads the order fields shared by NewOrderSingle,
+// OrderCancelReplaceRequest and ExecutionReport.
+func parseOrder(msg *Message) (core.Order, error) {
+	var order core.Order
+	qty, err := msg.Int(TagOrderQty)
+	if err != nil {
+		return order, err
+	}
+	order.Size = qty
+	sideValue, _ := msg.Get(TagSide)
+	switch sideValue {
+	case "1":
+		order.Direction = core.Long
+	case "2":
+		order.Direction = core.Short
+	default:
+		return order, fmt.Errorf("unsupported side %q", sideValue)
+	}
+	typeValue, _ := msg.Get(TagOrdType)
+	switch typeValue {
+	case "1":
+		order.Type = core.Market
+	case "2":
+		order.Type = core.Limit
+	case "3":
+		order.Type = core.Stop
+	case "4":
+		order.Type = core.StopLimit
+	default:
+		return order, fmt.Errorf("unsupported OrdType %q", typeValue)
+	}
+	tifValue, _ := msg.Get(TagTimeInForce)
+	switch tifValue {
+	case "0":
+		order.TimeInForce = core.Day
+	case "", "1":
+		order.TimeInForce = core.GTC
+	case "3":
+		order.TimeInForce = core.IOC
+	default:
+		return order, fmt.Errorf("unsupported TimeInForce %q", tifValue)
+	}
+	if price, err := msg.Float(TagPrice); err == nil {
+		order.Price = price
+	}
+	if stop, err := msg.Float(TagStopPx); err == nil {
+		order.StopPrice = stop
+	}
+	if ts, err := msg.Time(TagTransactTime); err == nil {
+		order.Timestamp = ts
+	}
+	return order, nil
+}
+
+func execType(t core.OrderEventType) string {
+	switch t {
+	case core.OrderAccepted:
+		return "0"
+	case core.OrderTriggered:
+		return "L"
+	case core.OrderPartiallyFilled, core.OrderFilled:
+		return "F"
+	case core.OrderModified:
+		return "5"
+	case core.OrderCancelled:
+		return "4"
+	case core.OrderExpired:
+		return "C"
+	default:
+		return "8"
+	}
+}
+
+func ordStatus(t core.OrderEventType, cumQty int64) string {
+	switch t {
+	case core.OrderFilled:
+		return "2"
+	case core.OrderCancelled:
+		return "4"
+	case core.OrderExpired:
+		return "C"
+	case core.OrderRejected:
+		return "8"
+	}
+	if cumQty > 0 {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,458 @@
+package fix
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/execution"
+)
+
+// DefaultTimeout bounds logon, logout and test-request round trips.
+const DefaultTimeout = 5 * time.Second
+
+// Initiator is a FIX 4.4 order-entry client implementing execution.Broker
+// and execution.AccountReporter.
+// Orders go out as NewOrderSingle, cancels as OrderCancelRequest and
+// modifies as OrderCancelReplaceRequest; ExecutionReports come back as
+// order events. The engine's order ID is the original ClOrdID; each cancel
+// or replace gets a derived ClOrdID that maps back to it.
+type Initiator struct {
+	Symbol string
+	Logger *log.Logger
+
+	session *Session
+	queue   execution.EventQueue
+
+	mu       sync.Mutex
+	orders   map[string]*fixOrder
+	clOrdID  map[string]string
+	queries  map[string]*accountQuery
+	querySeq int64
+}
+
+// accountQuery collects the reports answering one position or order
+// status request.
+type accountQuery struct {
+	positions []core.AccountPosition
+	orders    []core.Order
+	err       error
+}
+
+// fixOrder is the initiator's view of one engine order.
+type fixOrder struct {
+	order    core.Order
+	current  string
+	requests int
+}
+
+// NewInitiator prepares an initiator for symbol; Connect or Dial starts the
+// session.
+func NewInitiator(settings SessionSettings, store Store, symbol string, logger *log.Logger) *Initiator {
+	i := &Initiator{
+		Symbol:  symbol,
+		Logger:  logger,
+		orders:  map[string]*fixOrder{},
+		clOrdID: map[string]string{},
+		queries: map[string]*accountQuery{},
+	}
+	i.session = newSession(settings, store, logger, i.onApp)
+	return i
+}
+
+// Dial connects to an acceptor at addr and logs on.
+func Dial(addr string, settings SessionSettings, store Store, symbol string, logger *log.Logger) (*Initiator, error) {
+	conn, err := net.DialTimeout("tcp", addr, DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial fix %s: %w", addr, err)
+	}
+	i := NewInitiator(settings, store, symbol, logger)
+	if err := i.Connect(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return i, nil
+}
+
+// Connect logs on over an established connection.
+func (i *Initiator) Connect(conn net.Conn) error {
+	if err := i.session.start(conn, true); err != nil {
+		return err
+	}
+	return i.session.WaitLogon(DefaultTimeout)
+}
+
+// Session exposes the underlying session layer.
+func (i *Initiator) Session() *Session {
+	return i.session
+}
+
+// Close logs out.
+func (i *Initiator) Close() error {
+	return i.session.Logout("", DefaultTimeout)
+}
+
+// Err reports why the session ended, if it did.
+func (i *Initiator) Err() error {
+	select {
+	case <-i.session.Done():
+		if err := i.session.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("fix: session closed")
+	default:
+		return nil
+	}
+}
+
+// Sync waits until every message the acceptor sent so far is applied.
+func (i *Initiator) Sync() error {
+	return i.session.Ping(DefaultTimeout)
+}
+
+func (i *Initiator) Events() <-chan core.OrderEvent {
+	return i.queue.Events()
+}
+
+func (i *Initiator) Submit(order core.Order) error {
+	if order.ID == "" {
+		return fmt.Errorf("fix: order id required")
+	}
+	msg := NewMessage(MsgNewOrderSingle).Set(TagClOrdID, order.ID)
+	i.setOrderFields(msg, order)
+	i.mu.Lock()
+	i.orders[order.ID] = &fixOrder{order: order, current: order.ID}
+	i.clOrdID[order.ID] = order.ID
+	i.mu.Unlock()
+	return i.session.Send(msg)
+}
+
+func (i *Initiator) Cancel(id string) error {
+	i.mu.Lock()
+	tracked, ok := i.orders[id]
+	if !ok {
+		i.mu.Unlock()
+		return fmt.Errorf("fix: unknown order %s", id)
+	}
+	orig, clOrdID := i.nextClOrdID(tracked)
+	order := tracked.order
+	i.mu.Unlock()
+	msg := NewMessage(MsgOrderCancelRequest).
+		Set(TagClOrdID, clOrdID).
+		Set(TagOrigClOrdID, orig).
+		Set(TagSymbol, i.Symbol).
+		Set(TagSide, side(order.Direction)).
+		SetInt(TagOrderQty, order.Size).
+		SetTime(TagTransactTime, time.Now())
+	return i.session.Send(msg)
+}
+
+func (i *Initiator) Modify(id string, price, stopPrice float64, size int64) error {
+	i.mu.Lock()
+	tracked, ok := i.orders[id]
+	if !ok {
+		i.mu.Unlock()
+		return fmt.Errorf("fix: unknown order %s", id)
+	}
+	orig, clOrdID := i.nextClOrdID(tracked)
+	order := tracked.order
+	i.mu.Unlock()
+	order.Price = price
+	order.StopPrice = stopPrice
+	order.Size = size
+	msg := NewMessage(MsgOrderCancelReplaceRequest).
+		Set(TagClOrdID, clOrdID).
+		Set(TagOrigClOrdID, orig)
+	i.setOrderFields(msg, order)
+	return i.session.Send(msg)
+}
+
+// Positions sends a RequestForPositions and collects the PositionReports
+// that answer it.
+func (i *Initiator) Positions() ([]core.AccountPosition, error) {
+	id, query := i.startQuery("POS")
+	msg := NewMessage(MsgRequestForPositions).
+		Set(TagPosReqID, id).
+		Set(TagPosReqType, "0").
+		Set(TagSymbol, i.Symbol).
+		Set(TagClearingBusinessDate, time.Now().UTC().Format(dateFormat)).
+		SetTime(TagTransactTime, time.Now())
+	if err := i.finishQuery(id, msg); err != nil {
+		return nil, err
+	}
+	return query.positions, query.err
+}
+
+// OpenOrders sends an OrderMassStatusRequest for all orders and collects
+// the status ExecutionReports that answer it.
+func (i *Initiator) OpenOrders() ([]core.Order, error) {
+	id, query := i.startQuery("OMS")
+	msg := NewMessage(MsgOrderMassStatusRequest).
+		Set(TagMassStatusReqID, id).
+		Set(TagMassStatusReqType, "7")
+	if err := i.finishQuery(id, msg); err != nil {
+		return nil, err
+	}
+	return query.orders, query.err
+}
+
+func (i *Initiator) startQuery(prefix string) (string, *accountQuery) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.querySeq++
+	id := fmt.Sprintf("%s-%d", prefix, i.querySeq)
+	query := &accountQuery{}
+	i.queries[id] = query
+	return id, query
+}
+
+// finishQuery sends a query and waits for the acceptor to answer it: the
+// reports arrive before the heartbeat answering the TestRequest sent
+// after it.
+func (i *Initiator) finishQuery(id string, msg *Message) error {
+	defer func() {
+		i.mu.Lock()
+		delete(i.queries, id)
+		i.mu.Unlock()
+	}()
+	if err := i.session.Send(msg); err != nil {
+		return err
+	}
+	return i.Sync()
+}
+
+// nextClOrdID derives the ClOrdID for a cancel or replace. Callers hold mu.
+func (i *Initiator) nextClOrdID(tracked *fixOrder) (orig, next string) {
+	tracked.requests++
+	next = fmt.Sprintf("%s.%d", tracked.order.ID, tracked.requests)
+	i.clOrdID[next] = tracked.order.ID
+	return tracked.current, next
+}
+
+func (i *Initiator) setOrderFields(msg *Message, order core.Order) {
+	msg.Set(TagSymbol, i.Symbol).
+		Set(TagSide, side(order.Direction)).
+		SetTime(TagTransactTime, time.Now()).
+		SetInt(TagOrderQty, order.Size).
+		Set(TagOrdType, ordType(order.Type)).
+		Set(TagTimeInForce, timeInForce(order.TimeInForce))
+	if order.Type == core.Limit || order.Type == core.StopLimit {
+		msg.SetFloat(TagPrice, order.Price)
+	}
+	if order.Type == core.Stop || order.Type == core.StopLimit {
+		msg.SetFloat(TagStopPx, order.StopPrice)
+	}
+}
+
+// onApp handles application messages from the acceptor.
+func (i *Initiator) onApp(msg *Message) {
+	switch msg.Type() {
+	case MsgExecutionReport:
+		if execType, _ := msg.Get(TagExecType); execType == "I" {
+			i.statusReport(msg)
+			return
+		}
+		event, err := i.executionReport(msg)
+		if err != nil {
+			i.logf("execution report: %v", err)
+			return
+		}
+		i.queue.Publish(event)
+	case MsgPositionReport:
+		i.positionReport(msg)
+	case MsgRequestForPositionsAck:
+		reqID, _ := msg.Get(TagPosReqID)
+		result, _ := msg.Get(TagPosReqResult)
+		// 0 is a valid request, 2 one that found no positions.
+		if result != "0" && result != "2" {
+			text, _ := msg.Get(TagText)
+			i.mu.Lock()
+			if query, ok := i.queries[reqID]; ok {
+				query.err = fmt.Errorf("fix: position request rejected (%s): %s", result, text)
+			}
+			i.mu.Unlock()
+		}
+	case MsgOrderCancelReject:
+		clOrdID, _ := msg.Get(TagClOrdID)
+		text, _ := msg.Get(TagText)
+		i.logf("cancel/replace %s rejected: %s", clOrdID, text)
+	default:
+		i.logf("unhandled message type %s", msg.Type())
+	}
+}
+
+// executionReport maps an ExecutionReport onto the engine's order event.
+func (i *Initiator) executionReport(msg *Message) (core.OrderEvent, error) {
+	clOrdID, _ := msg.Get(TagClOrdID)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	id, ok := i.clOrdID[clOrdID]
+	if !ok {
+		return core.OrderEvent{}, fmt.Errorf("unknown ClOrdID %q", clOrdID)
+	}
+	tracked := i.orders[id]
+	execType, _ := msg.Get(TagExecType)
+	text, _ := msg.Get(TagText)
+	ts, err := msg.Time(TagTransactTime)
+	if err != nil {
+		ts, _ = msg.Time(TagSendingTime)
+	}
+	leaves, _ := msg.Int(TagLeavesQty)
+
+	event := core.OrderEvent{Timestamp: ts, Remaining: leaves, Reason: text}
+	switch execType {
+	case "0":
+		event.Type = core.OrderAccepted
+	case "8":
+		event.Type = core.OrderRejected
+	case "4":
+		event.Type = core.OrderCancelled
+	case "C":
+		event.Type = core.OrderExpired
+	case "L":
+		event.Type = core.OrderTriggered
+	case "5":
+		event.Type = core.OrderModified
+		tracked.current = clOrdID
+		if qty, err := msg.Int(TagOrderQty); err == nil {
+			tracked.order.Size = qty
+		}
+		if price, err := msg.Float(TagPrice); err == nil {
+			tracked.order.Price = price
+		}
+		if stop, err := msg.Float(TagStopPx); err == nil {
+			tracked.order.StopPrice = stop
+		}
+	case "F":
+		qty, err := msg.Int(TagLastQty)
+		if err != nil {
+			return event, err
+		}
+		price, err := msg.Float(TagLastPx)
+		if err != nil {
+			return event, err
+		}
+		commission, _ := msg.Float(TagCommission)
+		var fees float64
+		for _, amount := range msg.All(TagMiscFeeAmt) {
+			fee, err := strconv.ParseFloat(amount, 64)
+			if err != nil {
+				return event, fmt.Errorf("tag %d: %w", TagMiscFeeAmt, err)
+			}
+			fees += fee
+		}
+		event.Type = core.OrderPartiallyFilled
+		if status, _ := msg.Get(TagOrdStatus); status == "2" {
+			event.Type = core.OrderFilled
+		}
+		event.Fill = core.Fill{
+			OrderID:    id,
+			Timestamp:  ts,
+			Price:      price,
+			Size:       qty,
+			Direction:  tracked.order.Direction,
+			Commission: commission,
+			Fees:       fees,
+		}
+	default:
+		return event, fmt.Errorf("unsupported ExecType %q", execType)
+	}
+	event.Order = tracked.order
+	return event, nil
+}
+
+// positionReport adds a PositionReport's net quantity to its query.
+func (i *Initiator) positionReport(msg *Message) {
+	reqID, _ := msg.Get(TagPosReqID)
+	symbol, _ := msg.Get(TagSymbol)
+	var long, short int64
+	for _, qty := range msg.All(TagLongQty) {
+		n, _ := strconv.ParseInt(qty, 10, 64)
+		long += n
+	}
+	for _, qty := range msg.All(TagShortQty) {
+		n, _ := strconv.ParseInt(qty, 10, 64)
+		short += n
+	}
+	price, _ := msg.Float(TagSettlPrice)
+	position := core.AccountPosition{Symbol: symbol, Direction: core.Long, Size: long - short, AvgPrice: price}
+	if long < short {
+		position.Direction = core.Short
+		position.Size = short - long
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	query, ok := i.queries[reqID]
+	if !ok {
+		i.logf("position report for unknown request %q", reqID)
+		return
+	}
+	if position.Size != 0 {
+		query.positions = append(query.positions, position)
+	}
+}
+
+// statusReport adds an order status ExecutionReport to its mass status
+// query. Orders this initiator did not send keep their ClOrdID as the ID.
+func (i *Initiator) statusReport(msg *Message) {
+	reqID, _ := msg.Get(TagMassStatusReqID)
+	clOrdID, _ := msg.Get(TagClOrdID)
+	order, err := parseOrder(msg)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	query, ok := i.queries[reqID]
+	if !ok {
+		i.logf("status report for unknown request %q", reqID)
+		return
+	}
+	if err != nil {
+		query.err = fmt.Errorf("fix: status report %s: %w", clOrdID, err)
+		return
+	}
+	order.ID = clOrdID
+	if id, ok := i.clOrdID[clOrdID]; ok {
+		order.ID = id
+	}
+	query.orders = append(query.orders, order)
+}
+
+func (i *Initiator) logf(format string, args ...any) {
+	if i.Logger != nil {
+		i.Logger.Printf(format, args...)
+	}
+}
+
+func side(direction core.Direction) string {
+	if direction == core.Short {
+		return "2"
+	}
+	return "1"
+}
+
+func ordType(t core.OrderType) string {
+	switch t {
+	case core.Limit:
+		return "2"
+	case core.Stop:
+		return "3"
+	case core.StopLimit:
+		return "4"
+	default:
+		return "1"
+	}
+}
+
+func timeInForce(tif core.TimeInForce) string {
+	switch tif {
+	case core.Day:
+		return "0"
+	case core.IOC:
+		return "3"
+	default:
+		return "1"
+	}
+}
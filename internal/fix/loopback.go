@@ -0,0 +1,67 @@
+package fix
+
+import (
+	"log"
+	"net"
+
+	"trading-algo-generator/internal/core"
+)
+
+// Loopback runs an Initiator against an in-process Acceptor over an
+// in-memory connection, so the full FIX flow works offline. Every request
+// and bar is followed by a TestRequest round trip, which makes fills
+// available to the engine as deterministically as the mock broker's.
+type Loopback struct {
+	*Initiator
+	Acceptor *Acceptor
+}
+
+// NewLoopback logs an initiator for symbol on to acceptor. The initiator
+// takes the acceptor's CompIDs reversed.
+func NewLoopback(acceptor *Acceptor, store Store, symbol string, logger *log.Logger) (*Loopback, error) {
+	client, server := net.Pipe()
+	if err := acceptor.ServeConn(server); err != nil {
+		return nil, err
+	}
+	settings := SessionSettings{
+		SenderCompID: acceptor.Settings.TargetCompID,
+		TargetCompID: acceptor.Settings.SenderCompID,
+		HeartBtInt:   acceptor.Settings.HeartBtInt,
+		ResetSeqNums: acceptor.Settings.ResetSeqNums,
+	}
+	initiator := NewInitiator(settings, store, symbol, logger)
+	if err := initiator.Connect(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Loopback{Initiator: initiator, Acceptor: acceptor}, nil
+}
+
+// OnTick feeds the bar to the acceptor and waits for its reports.
+func (l *Loopback) OnTick(tick core.Tick) {
+	l.Acceptor.OnTick(tick)
+	if err := l.Sync(); err != nil {
+		l.logf("sync: %v", err)
+	}
+}
+
+func (l *Loopback) Submit(order core.Order) error {
+	if err := l.Initiator.Submit(order); err != nil {
+		return err
+	}
+	return l.Sync()
+}
+
+func (l *Loopback) Cancel(id string) error {
+	if err := l.Initiator.Cancel(id); err != nil {
+		return err
+	}
+	return l.Sync()
+}
+
+func (l *Loopback) Modify(id string, price, stopPrice float64, size int64) error {
+	if err := l.Initiator.Modify(id, price, stopPrice, size); err != nil {
+		return err
+	}
+	return l.Sync()
+}
@@ -0,0 +1,335 @@
+package fix
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"trading-algo-generator/internal/core"
+)
+
+var testStart = time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+
+func testAcceptor() *Acceptor {
+	return &Acceptor{Settings: SessionSettings{SenderCompID: "BROKER", TargetCompID: "ALGO", HeartBtInt: 30 * time.Second}}
+}
+
+// startLoopback logs on and feeds one bar so market orders can fill.
+func startLoopback(t *testing.T, acceptor *Acceptor, store Store, logger *log.Logger) *Loopback {
+	t.Helper()
+	l, err := NewLoopback(acceptor, store, "ES", logger)
+	if err != nil {
+		t.Fatalf("NewLoopback: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	l.OnTick(testTick(0, 5000))
+	return l
+}
+
+func testTick(minute int, price float64) core.Tick {
+	return core.Tick{
+		Timestamp: testStart.Add(time.Duration(minute) * time.Minute),
+		Open:      price, High: price + 1, Low: price - 1, Close: price,
+		Volume: 100, Symbol: "ES",
+	}
+}
+
+func nextEvent(t *testing.T, l *Loopback) core.OrderEvent {
+	t.Helper()
+	select {
+	case event := <-l.Events():
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no order event")
+		return core.OrderEvent{}
+	}
+}
+
+func noEvent(t *testing.T, l *Loopback) {
+	t.Helper()
+	select {
+	case event := <-l.Events():
+		t.Fatalf("unexpected %v event for %s", event.Type, event.Order.ID)
+	default:
+	}
+}
+
+// acceptorSide is the acceptor's session for the only logged-on initiator.
+func acceptorSide(t *testing.T, acceptor *Acceptor) *Session {
+	t.Helper()
+	acceptor.mu.Lock()
+	defer acceptor.mu.Unlock()
+	if len(acceptor.sessions) != 1 {
+		t.Fatalf("acceptor has %d sessions, want 1", len(acceptor.sessions))
+	}
+	return acceptor.sessions[0].session
+}
+
+// logBuffer collects log output written from the session goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLoopbackLogon(t *testing.T) {
+	acceptor := testAcceptor()
+	l, err := NewLoopback(acceptor, nil, "ES", nil)
+	if err != nil {
+		t.Fatalf("NewLoopback: %v", err)
+	}
+	server := acceptorSide(t, acceptor)
+	if err := l.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	// Logon then TestRequest each way.
+	client := l.Session().Seqs()
+	if want := (SeqNums{NextSender: 3, NextTarget: 3}); client != want {
+		t.Errorf("initiator seqs = %+v, want %+v", client, want)
+	}
+	if got := server.Seqs(); got.NextSender != client.NextTarget || got.NextTarget != client.NextSender {
+		t.Errorf("acceptor seqs = %+v, initiator %+v", got, client)
+	}
+	if l.Session().Settings.SenderCompID != "ALGO" || l.Session().Settings.TargetCompID != "BROKER" {
+		t.Errorf("initiator CompIDs = %s->%s", l.Session().Settings.SenderCompID, l.Session().Settings.TargetCompID)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-server.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("acceptor session still open after logout")
+	}
+	if err := server.Err(); err != nil {
+		t.Errorf("acceptor session ended with %v", err)
+	}
+}
+
+func TestLoopbackNewOrderSingle(t *testing.T) {
+	l := startLoopback(t, testAcceptor(), nil, nil)
+	order := core.Order{ID: "O1", Direction: core.Long, Size: 2, Type: core.Market}
+	if err := l.Submit(order); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if event := nextEvent(t, l); event.Type != core.OrderAccepted || event.Order.ID != "O1" {
+		t.Fatalf("first event = %v for %s, want accepted O1", event.Type, event.Order.ID)
+	}
+	event := nextEvent(t, l)
+	if event.Type != core.OrderFilled {
+		t.Fatalf("second event = %v, want filled", event.Type)
+	}
+	if event.Fill.OrderID != "O1" || event.Fill.Size != 2 || event.Fill.Price != 5000 || event.Fill.Direction != core.Long {
+		t.Errorf("fill = %+v", event.Fill)
+	}
+	if event.Remaining != 0 {
+		t.Errorf("remaining = %d, want 0", event.Remaining)
+	}
+
+	positions, err := l.Positions()
+	if err != nil {
+		t.Fatalf("Positions: %v", err)
+	}
+	if len(positions) != 1 || positions[0].Direction != core.Long || positions[0].Size != 2 {
+		t.Errorf("positions = %+v, want long 2", positions)
+	}
+
+	if err := l.Submit(order); err != nil {
+		t.Fatalf("Submit duplicate: %v", err)
+	}
+	if event := nextEvent(t, l); event.Type != core.OrderRejected || !strings.Contains(event.Reason, "duplicate") {
+		t.Errorf("duplicate ClOrdID gave %v %q, want rejected", event.Type, event.Reason)
+	}
+}
+
+func TestLoopbackCancelReplace(t *testing.T) {
+	l := startLoopback(t, testAcceptor(), nil, nil)
+	if err := l.Submit(core.Order{ID: "L1", Direction: core.Long, Size: 1, Type: core.Limit, Price: 4990}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if event := nextEvent(t, l); event.Type != core.OrderAccepted {
+		t.Fatalf("event = %v, want accepted", event.Type)
+	}
+
+	if err := l.Modify("L1", 4995, 0, 3); err != nil {
+		t.Fatalf("Modify: %v", err)
+	}
+	event := nextEvent(t, l)
+	if event.Type != core.OrderModified || event.Order.ID != "L1" || event.Order.Price != 4995 || event.Order.Size != 3 {
+		t.Fatalf("replace gave %v %+v, want modified L1 3 @ 4995", event.Type, event.Order)
+	}
+	orders, err := l.OpenOrders()
+	if err != nil {
+		t.Fatalf("OpenOrders: %v", err)
+	}
+	if len(orders) != 1 || orders[0].ID != "L1" || orders[0].Price != 4995 || orders[0].Size != 3 {
+		t.Errorf("open orders = %+v, want L1 3 @ 4995", orders)
+	}
+
+	// Each request takes a new ClOrdID chained from the last one accepted.
+	if err := l.Cancel("L1"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if event := nextEvent(t, l); event.Type != core.OrderCancelled || event.Order.ID != "L1" {
+		t.Fatalf("cancel gave %v for %s, want cancelled L1", event.Type, event.Order.ID)
+	}
+	if orders, err := l.OpenOrders(); err != nil || len(orders) != 0 {
+		t.Errorf("open orders after cancel = %+v, %v", orders, err)
+	}
+
+	// A cancel the acceptor refuses comes back as an OrderCancelReject, not
+	// an order event.
+	if err := l.Cancel("L1"); err != nil {
+		t.Fatalf("second Cancel: %v", err)
+	}
+	noEvent(t, l)
+	if err := l.Cancel("missing"); err == nil {
+		t.Errorf("cancel of an unknown order succeeded")
+	}
+}
+
+func TestLoopbackSequenceGap(t *testing.T) {
+	var logs logBuffer
+	acceptor := testAcceptor()
+	acceptor.Logger = log.New(&logs, "", 0)
+	l := startLoopback(t, acceptor, nil, acceptor.Logger)
+	server := acceptorSide(t, acceptor)
+
+	// Lose three of the acceptor's messages in transit.
+	server.mu.Lock()
+	server.seqs.NextSender += 3
+	server.mu.Unlock()
+	expected := l.Session().Seqs().NextTarget
+
+	// Submit without the loopback's Sync: the test request's heartbeat
+	// would fall inside the gap too, and heartbeats are gap-filled.
+	if err := l.Initiator.Submit(core.Order{ID: "G1", Direction: core.Short, Size: 1, Type: core.Market}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if event := nextEvent(t, l); event.Type != core.OrderAccepted {
+		t.Fatalf("event = %v, want accepted", event.Type)
+	}
+	if event := nextEvent(t, l); event.Type != core.OrderFilled || event.Fill.Size != 1 {
+		t.Fatalf("event = %v size %d, want filled 1", event.Type, event.Fill.Size)
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatalf("Sync after gap: %v", err)
+	}
+	if got, want := l.Session().Seqs().NextTarget, server.Seqs().NextSender; got != want {
+		t.Errorf("initiator expects %d, acceptor sends %d next", got, want)
+	}
+	out := logs.String()
+	for _, want := range []string{
+		fmt.Sprintf("sequence gap: expected %d, received %d", expected, expected+3),
+		fmt.Sprintf("resending %d-", expected),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLoopbackResendGapFillsStaleMessages(t *testing.T) {
+	acceptor := testAcceptor()
+	l := startLoopback(t, acceptor, nil, nil)
+	server := acceptorSide(t, acceptor)
+	before := l.Session().Seqs().NextTarget
+	if err := l.Submit(core.Order{ID: "S1", Direction: core.Long, Size: 1, Type: core.Market}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	nextEvent(t, l)
+	nextEvent(t, l)
+
+	// The initiator forgets S1's reports, which by now are older than the
+	// acceptor's resend window, and hears about them on the next order.
+	l.Session().mu.Lock()
+	l.Session().seqs.NextTarget = before
+	l.Session().mu.Unlock()
+	server.mu.Lock()
+	for seq, kept := range server.sent {
+		kept.at = kept.at.Add(-time.Hour)
+		server.sent[seq] = kept
+	}
+	server.mu.Unlock()
+	if err := l.Initiator.Submit(core.Order{ID: "S2", Direction: core.Long, Size: 1, Type: core.Market}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	for _, want := range []core.OrderEventType{core.OrderAccepted, core.OrderFilled} {
+		if event := nextEvent(t, l); event.Type != want || event.Order.ID != "S2" {
+			t.Fatalf("got %v for %s, want %v for S2", event.Type, event.Order.ID, want)
+		}
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	noEvent(t, l)
+	if got, want := l.Session().Seqs().NextTarget, server.Seqs().NextSender; got != want {
+		t.Errorf("initiator expects %d, acceptor sends %d next", got, want)
+	}
+}
+
+func TestLoopbackFileStoreReconnect(t *testing.T) {
+	dir := t.TempDir()
+	clientStore := FileStore{Path: filepath.Join(dir, "client.json")}
+	acceptor := testAcceptor()
+	acceptor.Store = FileStore{Path: filepath.Join(dir, "server.json")}
+
+	first := startLoopback(t, acceptor, clientStore, nil)
+	if err := first.Submit(core.Order{ID: "R1", Direction: core.Long, Size: 1, Type: core.Market}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	nextEvent(t, first)
+	nextEvent(t, first)
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Both logouts are sequenced and saved.
+	saved, err := clientStore.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if saved != first.Session().Seqs() {
+		t.Errorf("saved %+v, session ended at %+v", saved, first.Session().Seqs())
+	}
+	if saved.NextSender <= 1 || saved.NextTarget <= 1 {
+		t.Fatalf("saved seqs %+v did not advance", saved)
+	}
+
+	second, err := NewLoopback(acceptor, clientStore, "ES", nil)
+	if err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	t.Cleanup(func() { second.Close() })
+	server := acceptorSide(t, acceptor)
+	// The logon carried on from the saved numbers instead of 1.
+	if got := second.Session().Seqs(); got.NextSender != saved.NextSender+1 || got.NextTarget != saved.NextTarget+1 {
+		t.Errorf("after reconnect seqs = %+v, saved %+v", got, saved)
+	}
+	if got := server.Seqs(); got.NextTarget != saved.NextSender+1 {
+		t.Errorf("acceptor expects %d, want %d", got.NextTarget, saved.NextSender+1)
+	}
+	// Each session trades its own account, which needs a bar first.
+	second.OnTick(testTick(1, 5001))
+	if err := second.Submit(core.Order{ID: "R2", Direction: core.Short, Size: 1, Type: core.Market}); err != nil {
+		t.Fatalf("Submit after reconnect: %v", err)
+	}
+	if event := nextEvent(t, second); event.Type != core.OrderAccepted || event.Order.ID != "R2" {
+		t.Errorf("after reconnect got %v for %s, want accepted R2", event.Type, event.Order.ID)
+	}
+}
@@ -0,0 +1,333 @@
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	beginString = "FIX.4.4"
+	soh         = '\x01'
+	timeFormat  = "20060102-15:04:05.000"
+	dateFormat  = "20060102"
+)
+
+// Message types used by the session and order-entry flows.
+const (
+	MsgHeartbeat                 = "0"
+	MsgTestRequest               = "1"
+	MsgResendRequest             = "2"
+	MsgReject                    = "3"
+	MsgSequenceReset             = "4"
+	MsgLogout                    = "5"
+	MsgExecutionReport           = "8"
+	MsgOrderCancelReject         = "9"
+	MsgLogon                     = "A"
+	MsgNewOrderSingle            = "D"
+	MsgOrderCancelRequest        = "F"
+	MsgOrderCancelReplaceRequest = "G"
+	MsgOrderMassStatusRequest    = "AF"
+	MsgRequestForPositions       = "AN"
+	MsgRequestForPositionsAck    = "AO"
+	MsgPositionReport            = "AP"
+)
+
+// Tags used by this adapter.
+const (
+	TagAvgPx                = 6
+	TagBeginSeqNo           = 7
+	TagBeginString          = 8
+	TagBodyLength           = 9
+	TagCheckSum             = 10
+	TagClOrdID              = 11
+	TagCommission           = 12
+	TagCommType             = 13
+	TagCumQty               = 14
+	TagEndSeqNo             = 16
+	TagExecID               = 17
+	TagLastPx               = 31
+	TagLastQty              = 32
+	TagMsgSeqNum            = 34
+	TagMsgType              = 35
+	TagNewSeqNo             = 36
+	TagOrderID              = 37
+	TagOrderQty             = 38
+	TagOrdStatus            = 39
+	TagOrdType              = 40
+	TagOrigClOrdID          = 41
+	TagPossDupFlag          = 43
+	TagRefSeqNum            = 45
+	TagPrice                = 44
+	TagSenderCompID         = 49
+	TagSendingTime          = 52
+	TagSide                 = 54
+	TagSymbol               = 55
+	TagTargetCompID         = 56
+	TagText                 = 58
+	TagTimeInForce          = 59
+	TagTransactTime         = 60
+	TagEncryptMethod        = 98
+	TagStopPx               = 99
+	TagCxlRejReason         = 102
+	TagHeartBtInt           = 108
+	TagTestReqID            = 112
+	TagOrigSendingTime      = 122
+	TagGapFillFlag          = 123
+	TagNoMiscFees           = 136
+	TagMiscFeeAmt           = 137
+	TagMiscFeeType          = 139
+	TagResetSeqNumFlag      = 141
+	TagExecType             = 150
+	TagLeavesQty            = 151
+	TagCxlRejResponseTo     = 434
+	TagMassStatusReqID      = 584
+	TagMassStatusReqType    = 585
+	TagNoPositions          = 702
+	TagPosType              = 703
+	TagLongQty              = 704
+	TagShortQty             = 705
+	TagPosReqID             = 710
+	TagClearingBusinessDate = 715
+	TagPosMaintRptID        = 721
+	TagPosReqType           = 724
+	TagTotalNumPosReports   = 727
+	TagPosReqResult         = 728
+	TagPosReqStatus         = 729
+	TagSettlPrice           = 730
+	TagTotNumReports        = 911
+	TagLastRptRequested     = 912
+)
+
+// headerOrder is where standard header fields go after MsgType, regardless
+// of the order they were set in.
+var headerOrder = []int{TagSenderCompID, TagTargetCompID, TagMsgSeqNum, TagPossDupFlag, TagSendingTime, TagOrigSendingTime}
+
+// Field is one tag=value pair.
+type Field struct {
+	Tag   int
+	Value string
+}
+
+// Message is a FIX message without BeginString, BodyLength and CheckSum,
+// which are added on encoding. Fields keep their order, so repeating groups
+// round-trip.
+type Message struct {
+	Fields []Field
+}
+
+// NewMessage starts a message of msgType.
+func NewMessage(msgType string) *Message {
+	return &Message{Fields: []Field{{Tag: TagMsgType, Value: msgType}}}
+}
+
+// Type is the MsgType.
+func (m *Message) Type() string {
+	value, _ := m.Get(TagMsgType)
+	return value
+}
+
+// Set replaces the first field with tag, or appends it.
+func (m *Message) Set(tag int, value string) *Message {
+	for i := range m.Fields {
+		if m.Fields[i].Tag == tag {
+			m.Fields[i].Value = value
+			return m
+		}
+	}
+	m.Fields = append(m.Fields, Field{Tag: tag, Value: value})
+	return m
+}
+
+// Add appends a field even if the tag is already present, for repeating
+// groups.
+func (m *Message) Add(tag int, value string) *Message {
+	m.Fields = append(m.Fields, Field{Tag: tag, Value: value})
+	return m
+}
+
+func (m *Message) SetInt(tag int, value int64) *Message {
+	return m.Set(tag, strconv.FormatInt(value, 10))
+}
+
+func (m *Message) SetFloat(tag int, value float64) *Message {
+	return m.Set(tag, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (m *Message) SetTime(tag int, value time.Time) *Message {
+	return m.Set(tag, value.UTC().Format(timeFormat))
+}
+
+// Get returns the first field with tag.
+func (m *Message) Get(tag int) (string, bool) {
+	for _, field := range m.Fields {
+		if field.Tag == tag {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// All returns every value of tag in order.
+func (m *Message) All(tag int) []string {
+	var values []string
+	for _, field := range m.Fields {
+		if field.Tag == tag {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
+
+func (m *Message) Int(tag int) (int64, error) {
+	value, ok := m.Get(tag)
+	if !ok {
+		return 0, fmt.Errorf("tag %d missing", tag)
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("tag %d: %w", tag, err)
+	}
+	return n, nil
+}
+
+func (m *Message) Float(tag int) (float64, error) {
+	value, ok := m.Get(tag)
+	if !ok {
+		return 0, fmt.Errorf("tag %d missing", tag)
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("tag %d: %w", tag, err)
+	}
+	return f, nil
+}
+
+func (m *Message) Time(tag int) (time.Time, error) {
+	value, ok := m.Get(tag)
+	if !ok {
+		return time.Time{}, fmt.Errorf("tag %d missing", tag)
+	}
+	return time.Parse(timeFormat, value)
+}
+
+// Clone copies the message so it can be restamped.
+func (m *Message) Clone() *Message {
+	return &Message{Fields: append([]Field(nil), m.Fields...)}
+}
+
+// Bytes encodes the message with BeginString, BodyLength and CheckSum.
+func (m *Message) Bytes() []byte {
+	var body bytes.Buffer
+	write := func(tag int, value string) {
+		body.WriteString(strconv.Itoa(tag))
+		body.WriteByte('=')
+		body.WriteString(value)
+		body.WriteByte(soh)
+	}
+	write(TagMsgType, m.Type())
+	for _, tag := range headerOrder {
+		if value, ok := m.Get(tag); ok {
+			write(tag, value)
+		}
+	}
+	for _, field := range m.Fields {
+		if field.Tag == TagMsgType || isHeader(field.Tag) {
+			continue
+		}
+		write(field.Tag, field.Value)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "8=%s\x019=%d\x01", beginString, body.Len())
+	out.Write(body.Bytes())
+	fmt.Fprintf(&out, "10=%03d\x01", checksum(out.Bytes()))
+	return out.Bytes()
+}
+
+// String renders the message with | separators for logs.
+func (m *Message) String() string {
+	return string(bytes.ReplaceAll(m.Bytes(), []byte{soh}, []byte{'|'}))
+}
+
+func isHeader(tag int) bool {
+	for _, header := range headerOrder {
+		if tag == header {
+			return true
+		}
+	}
+	return false
+}
+
+func checksum(data []byte) int {
+	var sum int
+	for _, b := range data {
+		sum += int(b)
+	}
+	return sum % 256
+}
+
+// ReadMessage reads one message, validating BeginString, BodyLength and
+// CheckSum.
+func ReadMessage(r *bufio.Reader) (*Message, error) {
+	begin, err := r.ReadString(soh)
+	if err != nil {
+		return nil, err
+	}
+	if begin != "8="+beginString+string(soh) {
+		return nil, fmt.Errorf("fix: unexpected begin string %q", begin)
+	}
+	lengthField, err := r.ReadString(soh)
+	if err != nil {
+		return nil, err
+	}
+	if len(lengthField) < 4 || lengthField[:2] != "9=" {
+		return nil, fmt.Errorf("fix: missing body length")
+	}
+	length, err := strconv.Atoi(lengthField[2 : len(lengthField)-1])
+	if err != nil || length <= 0 {
+		return nil, fmt.Errorf("fix: bad body length %q", lengthField)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	trailer, err := r.ReadString(soh)
+	if err != nil {
+		return nil, err
+	}
+	if len(trailer) != 7 || trailer[:3] != "10=" {
+		return nil, fmt.Errorf("fix: bad trailer %q", trailer)
+	}
+	want, err := strconv.Atoi(trailer[3:6])
+	if err != nil {
+		return nil, fmt.Errorf("fix: bad checksum %q", trailer)
+	}
+	var raw bytes.Buffer
+	raw.WriteString(begin)
+	raw.WriteString(lengthField)
+	raw.Write(body)
+	if got := checksum(raw.Bytes()); got != want {
+		return nil, fmt.Errorf("fix: checksum %03d, expected %03d", got, want)
+	}
+
+	msg := &Message{}
+	for _, part := range bytes.Split(bytes.TrimSuffix(body, []byte{soh}), []byte{soh}) {
+		eq := bytes.IndexByte(part, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("fix: malformed field %q", part)
+		}
+		tag, err := strconv.Atoi(string(part[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("fix: malformed tag %q", part[:eq])
+		}
+		msg.Fields = append(msg.Fields, Field{Tag: tag, Value: string(part[eq+1:])})
+	}
+	if msg.Type() == "" {
+		return nil, fmt.Errorf("fix: missing MsgType")
+	}
+	return msg, nil
+}
@@ -0,0 +1,706 @@
+package fix
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultHeartBtInt is used when SessionSettings leave HeartBtInt unset.
+const DefaultHeartBtInt = 30 * time.Second
+
+// DefaultResendWindow is used when SessionSettings leave ResendWindow unset.
+const DefaultResendWindow = 5 * time.Second
+
+// SessionSettings identify one side of a FIX session.
+type SessionSettings struct {
+	SenderCompID string
+	TargetCompID string
+	HeartBtInt   time.Duration
+	// ResetSeqNums restarts both sequence numbers at 1 on logon
+	// (ResetSeqNumFlag). Otherwise they continue from the Store.
+	ResetSeqNums bool
+	// ResendWindow is how long sent application messages are kept for
+	// resending. Older ones are gap-filled, so a resend never puts a stale
+	// order back on the market; broker reconciliation repairs what they
+	// carried.
+	ResendWindow time.Duration
+}
+
+// Session runs the FIX session layer over one connection: logon,
+// heartbeats and test requests, sequence checking with ResendRequest and
+// gap fills, and logout. Application messages reach the handler in
+// sequence order.
+type Session struct {
+	Settings SessionSettings
+	Store    Store
+	Logger   *log.Logger
+
+	handler   func(*Message)
+	initiator bool
+	conn      net.Conn
+
+	// sendMu orders sequence assignment; outbound is drained by writeLoop
+	// so a send never waits on the peer reading.
+	sendMu   sync.Mutex
+	outbound [][]byte
+	wake     chan struct{}
+
+	mu          sync.Mutex
+	seqs        SeqNums
+	sent        map[int64]sentMessage
+	sentFloor   int64
+	lastSent    time.Time
+	lastRecv    time.Time
+	resendUntil int64
+	testPending bool
+	testSeq     int64
+	waiters     map[string]chan struct{}
+	loggedOn    bool
+	logoutSent  bool
+	logon       chan struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+	err         error
+}
+
+// sentMessage is an application message kept for resending.
+type sentMessage struct {
+	msg *Message
+	at  time.Time
+}
+
+func newSession(settings SessionSettings, store Store, logger *log.Logger, handler func(*Message)) *Session {
+	if settings.HeartBtInt <= 0 {
+		settings.HeartBtInt = DefaultHeartBtInt
+	}
+	if settings.ResendWindow <= 0 {
+		settings.ResendWindow = DefaultResendWindow
+	}
+	if store == nil {
+		store = &MemoryStore{}
+	}
+	return &Session{
+		Settings: settings,
+		Store:    store,
+		Logger:   logger,
+		handler:  handler,
+		wake:     make(chan struct{}, 1),
+		sent:     map[int64]sentMessage{},
+		waiters:  map[string]chan struct{}{},
+		logon:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start loads the sequence numbers and begins reading, writing and
+// heartbeating on conn. An initiator sends its Logon immediately.
+func (s *Session) start(conn net.Conn, initiator bool) error {
+	seqs, err := s.Store.Load()
+	if err != nil {
+		return fmt.Errorf("fix: load sequence numbers: %w", err)
+	}
+	if initiator && s.Settings.ResetSeqNums {
+		seqs = SeqNums{NextSender: 1, NextTarget: 1}
+		if err := s.Store.Save(seqs); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	s.mu.Lock()
+	s.conn = conn
+	s.initiator = initiator
+	s.seqs = seqs
+	s.lastSent = now
+	s.lastRecv = now
+	s.mu.Unlock()
+
+	go s.writeLoop()
+	go s.readLoop()
+	go s.heartbeatLoop()
+	if initiator {
+		logon := NewMessage(MsgLogon).
+			Set(TagEncryptMethod, "0").
+			SetInt(TagHeartBtInt, int64(s.Settings.HeartBtInt/time.Second))
+		if s.Settings.ResetSeqNums {
+			logon.Set(TagResetSeqNumFlag, "Y")
+		}
+		return s.send(logon)
+	}
+	return nil
+}
+
+// WaitLogon blocks until the counterparty has acknowledged the logon.
+func (s *Session) WaitLogon(timeout time.Duration) error {
+	select {
+	case <-s.logon:
+		return nil
+	case <-s.done:
+		return s.Err()
+	case <-time.After(timeout):
+		return fmt.Errorf("fix: logon timed out")
+	}
+}
+
+// Send sends an application message once logged on.
+func (s *Session) Send(msg *Message) error {
+	s.mu.Lock()
+	loggedOn := s.loggedOn
+	s.mu.Unlock()
+	if !loggedOn {
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("fix: not logged on")
+	}
+	return s.send(msg)
+}
+
+// Ping sends a TestRequest and waits for its Heartbeat. Because both sides
+// process messages in order, everything the counterparty sent before the
+// Heartbeat has been handled when Ping returns.
+func (s *Session) Ping(timeout time.Duration) error {
+	s.mu.Lock()
+	s.testSeq++
+	id := fmt.Sprintf("PING-%d", s.testSeq)
+	reply := make(chan struct{})
+	s.waiters[id] = reply
+	s.mu.Unlock()
+	if err := s.Send(NewMessage(MsgTestRequest).Set(TagTestReqID, id)); err != nil {
+		return err
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-s.done:
+		return s.Err()
+	case <-time.After(timeout):
+		s.mu.Lock()
+		delete(s.waiters, id)
+		s.mu.Unlock()
+		return fmt.Errorf("fix: test request %s timed out", id)
+	}
+}
+
+// Logout sends a Logout and waits briefly for the counterparty's reply
+// before closing the connection.
+func (s *Session) Logout(text string, timeout time.Duration) error {
+	s.mu.Lock()
+	loggedOn := s.loggedOn
+	s.mu.Unlock()
+	if loggedOn {
+		if err := s.sendLogout(text); err == nil {
+			select {
+			case <-s.done:
+			case <-time.After(timeout):
+			}
+		}
+	}
+	s.close(nil)
+	return nil
+}
+
+// Done is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err is why the session ended, or nil after a clean logout.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Seqs returns the next sequence numbers to send and expect.
+func (s *Session) Seqs() SeqNums {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seqs
+}
+
+func (s *Session) send(msg *Message) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	select {
+	case <-s.done:
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("fix: session closed")
+	default:
+	}
+	s.mu.Lock()
+	seq := s.seqs.NextSender
+	s.seqs.NextSender++
+	seqs := s.seqs
+	s.mu.Unlock()
+	if err := s.Store.Save(seqs); err != nil {
+		return fmt.Errorf("fix: save sequence numbers: %w", err)
+	}
+	msg.SetInt(TagMsgSeqNum, seq)
+	s.stamp(msg)
+	if !isAdmin(msg.Type()) {
+		now := time.Now()
+		s.mu.Lock()
+		s.sent[seq] = sentMessage{msg: msg.Clone(), at: now}
+		s.pruneSent(now)
+		s.mu.Unlock()
+	}
+	s.enqueue(msg)
+	return nil
+}
+
+// stamp sets the CompIDs and SendingTime.
+func (s *Session) stamp(msg *Message) {
+	msg.Set(TagSenderCompID, s.Settings.SenderCompID)
+	msg.Set(TagTargetCompID, s.Settings.TargetCompID)
+	msg.SetTime(TagSendingTime, time.Now())
+}
+
+// enqueue hands an already sequenced message to the writer.
+func (s *Session) enqueue(msg *Message) {
+	s.mu.Lock()
+	s.outbound = append(s.outbound, msg.Bytes())
+	s.lastSent = time.Now()
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) writeLoop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		s.mu.Lock()
+		pending := s.outbound
+		s.outbound = nil
+		s.mu.Unlock()
+		for _, data := range pending {
+			if _, err := s.conn.Write(data); err != nil {
+				s.close(fmt.Errorf("fix: write: %w", err))
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) readLoop() {
+	reader := bufio.NewReader(s.conn)
+	for {
+		msg, err := ReadMessage(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+				s.mu.Lock()
+				clean := s.logoutSent
+				s.mu.Unlock()
+				if clean {
+					err = nil
+				} else {
+					err = fmt.Errorf("fix: connection closed")
+				}
+			}
+			s.close(err)
+			return
+		}
+		s.mu.Lock()
+		s.lastRecv = time.Now()
+		s.testPending = false
+		s.mu.Unlock()
+		if err := s.receive(msg); err != nil {
+			s.logf("%v", err)
+			s.sendLogout(err.Error())
+			s.close(err)
+			return
+		}
+	}
+}
+
+func (s *Session) heartbeatLoop() {
+	s.mu.Lock()
+	check := s.Settings.HeartBtInt / 4
+	s.mu.Unlock()
+	if check > time.Second {
+		check = time.Second
+	}
+	if check < 10*time.Millisecond {
+		check = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			interval := s.Settings.HeartBtInt
+			loggedOn := s.loggedOn
+			sinceSent := now.Sub(s.lastSent)
+			sinceRecv := now.Sub(s.lastRecv)
+			testPending := s.testPending
+			s.mu.Unlock()
+			if !loggedOn {
+				continue
+			}
+			switch {
+			case sinceRecv > 2*interval:
+				s.close(fmt.Errorf("fix: no messages for %s", sinceRecv.Round(time.Second)))
+				return
+			case sinceRecv > interval+interval/5 && !testPending:
+				s.mu.Lock()
+				s.testPending = true
+				s.testSeq++
+				id := fmt.Sprintf("TEST-%d", s.testSeq)
+				s.mu.Unlock()
+				s.send(NewMessage(MsgTestRequest).Set(TagTestReqID, id))
+			case sinceSent >= interval:
+				s.send(NewMessage(MsgHeartbeat))
+			}
+		}
+	}
+}
+
+// receive applies sequence checking before dispatching a message.
+func (s *Session) receive(msg *Message) error {
+	seq, err := msg.Int(TagMsgSeqNum)
+	if err != nil {
+		return fmt.Errorf("fix: %w", err)
+	}
+	sender, _ := msg.Get(TagSenderCompID)
+	target, _ := msg.Get(TagTargetCompID)
+	if sender != s.Settings.TargetCompID || target != s.Settings.SenderCompID {
+		return fmt.Errorf("fix: unexpected CompIDs %s->%s", sender, target)
+	}
+	possDup := flag(msg, TagPossDupFlag)
+
+	s.mu.Lock()
+	loggedOn := s.loggedOn
+	s.mu.Unlock()
+	switch msg.Type() {
+	case MsgLogon:
+		return s.onLogon(msg, seq)
+	case MsgSequenceReset:
+		return s.onSequenceReset(msg, seq, possDup)
+	}
+	if !loggedOn {
+		return fmt.Errorf("fix: %s received before logon", msg.Type())
+	}
+
+	expected := s.Seqs().NextTarget
+	switch {
+	case seq > expected:
+		s.requestResend(expected, seq)
+		switch msg.Type() {
+		case MsgResendRequest:
+			// Serviced out of order so both sides can recover at once.
+			return s.onResendRequest(msg)
+		case MsgLogout:
+			s.close(fmt.Errorf("fix: logout with sequence gap"))
+		}
+		// Dropped; the resend delivers it again in order.
+		return nil
+	case seq < expected:
+		if possDup {
+			return nil
+		}
+		return fmt.Errorf("fix: MsgSeqNum too low, expecting %d but received %d", expected, seq)
+	}
+	if err := s.advanceTarget(seq + 1); err != nil {
+		return err
+	}
+	return s.dispatch(msg)
+}
+
+func (s *Session) onLogon(msg *Message, seq int64) error {
+	s.mu.Lock()
+	initiator := s.initiator
+	loggedOn := s.loggedOn
+	s.mu.Unlock()
+	if loggedOn {
+		return fmt.Errorf("fix: unexpected second logon")
+	}
+	if !initiator {
+		if heartBtInt, err := msg.Int(TagHeartBtInt); err == nil && heartBtInt > 0 {
+			s.mu.Lock()
+			s.Settings.HeartBtInt = time.Duration(heartBtInt) * time.Second
+			s.mu.Unlock()
+		}
+		if flag(msg, TagResetSeqNumFlag) {
+			s.mu.Lock()
+			s.seqs = SeqNums{NextSender: 1, NextTarget: 1}
+			s.sent = map[int64]sentMessage{}
+			s.sentFloor = 0
+			seqs := s.seqs
+			s.mu.Unlock()
+			if err := s.Store.Save(seqs); err != nil {
+				return err
+			}
+		}
+	}
+	expected := s.Seqs().NextTarget
+	if seq < expected {
+		return fmt.Errorf("fix: MsgSeqNum too low, expecting %d but received %d", expected, seq)
+	}
+
+	s.mu.Lock()
+	s.loggedOn = true
+	s.mu.Unlock()
+	if !initiator {
+		s.mu.Lock()
+		heartBtInt := s.Settings.HeartBtInt
+		s.mu.Unlock()
+		reply := NewMessage(MsgLogon).
+			Set(TagEncryptMethod, "0").
+			SetInt(TagHeartBtInt, int64(heartBtInt/time.Second))
+		if flag(msg, TagResetSeqNumFlag) {
+			reply.Set(TagResetSeqNumFlag, "Y")
+		}
+		if err := s.send(reply); err != nil {
+			return err
+		}
+	}
+	close(s.logon)
+	s.logf("logged on %s->%s", s.Settings.SenderCompID, s.Settings.TargetCompID)
+	if seq > expected {
+		s.requestResend(expected, seq)
+		return nil
+	}
+	return s.advanceTarget(seq + 1)
+}
+
+func (s *Session) onSequenceReset(msg *Message, seq int64, possDup bool) error {
+	newSeq, err := msg.Int(TagNewSeqNo)
+	if err != nil {
+		return fmt.Errorf("fix: sequence reset: %w", err)
+	}
+	expected := s.Seqs().NextTarget
+	if flag(msg, TagGapFillFlag) {
+		if seq > expected {
+			s.requestResend(expected, seq)
+			return nil
+		}
+		if seq < expected {
+			if possDup {
+				return nil
+			}
+			return fmt.Errorf("fix: MsgSeqNum too low, expecting %d but received %d", expected, seq)
+		}
+	}
+	if newSeq < expected {
+		return fmt.Errorf("fix: sequence reset to %d below expected %d", newSeq, expected)
+	}
+	return s.advanceTarget(newSeq)
+}
+
+func (s *Session) dispatch(msg *Message) error {
+	switch msg.Type() {
+	case MsgHeartbeat:
+		if id, ok := msg.Get(TagTestReqID); ok {
+			s.mu.Lock()
+			reply, waiting := s.waiters[id]
+			delete(s.waiters, id)
+			s.mu.Unlock()
+			if waiting {
+				close(reply)
+			}
+		}
+	case MsgTestRequest:
+		id, _ := msg.Get(TagTestReqID)
+		return s.send(NewMessage(MsgHeartbeat).Set(TagTestReqID, id))
+	case MsgResendRequest:
+		return s.onResendRequest(msg)
+	case MsgReject:
+		text, _ := msg.Get(TagText)
+		ref, _ := msg.Get(TagRefSeqNum)
+		s.logf("session reject of %s: %s", ref, text)
+	case MsgLogout:
+		text, _ := msg.Get(TagText)
+		s.mu.Lock()
+		replied := s.logoutSent
+		s.mu.Unlock()
+		if !replied {
+			s.sendLogout("")
+		}
+		if text != "" {
+			s.logf("logout: %s", text)
+		}
+		s.close(nil)
+	default:
+		if s.handler != nil {
+			s.handler(msg)
+		}
+	}
+	return nil
+}
+
+// onResendRequest resends application messages sent within the
+// ResendWindow as PossDup and gap-fills over admin messages and anything
+// older or no longer held.
+func (s *Session) onResendRequest(msg *Message) error {
+	begin, err := msg.Int(TagBeginSeqNo)
+	if err != nil {
+		return fmt.Errorf("fix: resend request: %w", err)
+	}
+	end, err := msg.Int(TagEndSeqNo)
+	if err != nil {
+		return fmt.Errorf("fix: resend request: %w", err)
+	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.mu.Lock()
+	last := s.seqs.NextSender - 1
+	s.mu.Unlock()
+	if end == 0 || end > last {
+		end = last
+	}
+	s.logf("resending %d-%d", begin, end)
+	now := time.Now()
+	s.mu.Lock()
+	s.pruneSent(now)
+	s.mu.Unlock()
+	var gapStart int64
+	for seq := begin; seq <= end; seq++ {
+		s.mu.Lock()
+		kept, ok := s.sent[seq]
+		s.mu.Unlock()
+		if !ok {
+			if gapStart == 0 {
+				gapStart = seq
+			}
+			continue
+		}
+		if gapStart != 0 {
+			s.enqueue(s.gapFill(gapStart, seq))
+			gapStart = 0
+		}
+		dup := kept.msg.Clone()
+		sendingTime, _ := kept.msg.Get(TagSendingTime)
+		dup.Set(TagPossDupFlag, "Y")
+		dup.Set(TagOrigSendingTime, sendingTime)
+		dup.SetTime(TagSendingTime, time.Now())
+		s.enqueue(dup)
+	}
+	if gapStart != 0 {
+		s.enqueue(s.gapFill(gapStart, end+1))
+	}
+	return nil
+}
+
+// pruneSent drops kept messages older than the ResendWindow. Messages are
+// kept in sequence order, so it stops at the first one still in the window.
+// Callers hold mu.
+func (s *Session) pruneSent(now time.Time) {
+	for ; s.sentFloor < s.seqs.NextSender; s.sentFloor++ {
+		if kept, ok := s.sent[s.sentFloor]; ok {
+			if now.Sub(kept.at) <= s.Settings.ResendWindow {
+				return
+			}
+			delete(s.sent, s.sentFloor)
+		}
+	}
+}
+
+func (s *Session) gapFill(seq, newSeq int64) *Message {
+	msg := NewMessage(MsgSequenceReset).
+		Set(TagGapFillFlag, "Y").
+		SetInt(TagNewSeqNo, newSeq).
+		SetInt(TagMsgSeqNum, seq).
+		Set(TagPossDupFlag, "Y")
+	s.stamp(msg)
+	return msg
+}
+
+// requestResend asks for everything from expected on, once per gap.
+func (s *Session) requestResend(expected, received int64) {
+	s.mu.Lock()
+	if s.resendUntil >= received {
+		s.mu.Unlock()
+		return
+	}
+	s.resendUntil = received
+	s.mu.Unlock()
+	s.logf("sequence gap: expected %d, received %d", expected, received)
+	s.send(NewMessage(MsgResendRequest).SetInt(TagBeginSeqNo, expected).SetInt(TagEndSeqNo, 0))
+}
+
+func (s *Session) advanceTarget(next int64) error {
+	s.mu.Lock()
+	s.seqs.NextTarget = next
+	if next > s.resendUntil {
+		s.resendUntil = 0
+	}
+	seqs := s.seqs
+	s.mu.Unlock()
+	if err := s.Store.Save(seqs); err != nil {
+		return fmt.Errorf("fix: save sequence numbers: %w", err)
+	}
+	return nil
+}
+
+func (s *Session) sendLogout(text string) error {
+	s.mu.Lock()
+	s.logoutSent = true
+	s.mu.Unlock()
+	msg := NewMessage(MsgLogout)
+	if text != "" {
+		msg.Set(TagText, text)
+	}
+	return s.send(msg)
+}
+
+func (s *Session) close(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		pending := s.outbound
+		s.outbound = nil
+		conn := s.conn
+		s.mu.Unlock()
+		// Flush what is already sequenced (e.g. a Logout) before closing.
+		if conn != nil {
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			for _, data := range pending {
+				if _, werr := conn.Write(data); werr != nil {
+					break
+				}
+			}
+		}
+		close(s.done)
+		if conn != nil {
+			conn.Close()
+		}
+		if err != nil {
+			s.logf("session ended: %v", err)
+		}
+	})
+}
+
+func (s *Session) logf(format string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
+
+func isAdmin(msgType string) bool {
+	switch msgType {
+	case MsgHeartbeat, MsgTestRequest, MsgResendRequest, MsgReject, MsgSequenceReset, MsgLogout, MsgLogon:
+		return true
+	}
+	return false
+}
+
+func flag(msg *Message, tag int) bool {
+	value, _ := msg.Get(tag)
+	return value == "Y"
+}
@@ -0,0 +1,80 @@
+package fix
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"trading-algo-generator/internal/storage"
+)
+
+// SeqNums are the next sequence numbers a session will send and expect.
+type SeqNums struct {
+	NextSender int64 `json:"next_sender"`
+	NextTarget int64 `json:"next_target"`
+}
+
+// Store persists a session's sequence numbers across restarts.
+type Store interface {
+	Load() (SeqNums, error)
+	Save(SeqNums) error
+}
+
+// MemoryStore keeps sequence numbers for the life of the process.
+type MemoryStore struct {
+	mu   sync.Mutex
+	seqs SeqNums
+}
+
+func (s *MemoryStore) Load() (SeqNums, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return normalizeSeqs(s.seqs), nil
+}
+
+func (s *MemoryStore) Save(seqs SeqNums) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seqs = seqs
+	return nil
+}
+
+// FileStore keeps sequence numbers in a JSON file, replaced atomically on
+// every save.
+type FileStore struct {
+	Path string
+}
+
+func (s FileStore) Load() (SeqNums, error) {
+	var seqs SeqNums
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return normalizeSeqs(seqs), nil
+	}
+	if err != nil {
+		return seqs, err
+	}
+	if err := json.Unmarshal(data, &seqs); err != nil {
+		return seqs, err
+	}
+	return normalizeSeqs(seqs), nil
+}
+
+func (s FileStore) Save(seqs SeqNums) error {
+	data, err := json.Marshal(seqs)
+	if err != nil {
+		return err
+	}
+	return storage.WriteFileAtomic(s.Path, data)
+}
+
+func normalizeSeqs(seqs SeqNums) SeqNums {
+	if seqs.NextSender < 1 {
+		seqs.NextSender = 1
+	}
+	if seqs.NextTarget < 1 {
+		seqs.NextTarget = 1
+	}
+	return seqs
+}
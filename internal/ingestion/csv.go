@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"trading-algo-generator/internal/calendar"
 	"trading-algo-generator/internal/core"
 )
 
@@ -17,9 +18,11 @@ const (
 	CSVTimestampLayout = time.RFC3339Nano
 )
 
-// CSVReader loads ticks from a CSV file.
+// CSVReader loads ticks from a CSV file. With a Calendar, rows with an
+// empty session column are labelled from the exchange schedule.
 type CSVReader struct {
-	Path string
+	Path     string
+	Calendar *calendar.Calendar
 }
 
 func (r CSVReader) Stream() (<-chan core.Tick, <-chan error) {
@@ -62,6 +65,9 @@ func (r CSVReader) Stream() (<-chan core.Tick, <-chan error) {
 				errCh <- err
 				return
 			}
+			if tick.Session == "" && r.Calendar != nil {
+				tick.Session = r.Calendar.Session(tick.Timestamp)
+			}
 			out <- tick
 		}
 	}()
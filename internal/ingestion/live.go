@@ -9,6 +9,9 @@ import (
 // LiveSimulator emits ticks from a historical stream, preserving timestamp gaps.
 type LiveSimulator struct {
 	Speed float64
+	// After drops ticks at or before it, e.g. those a resumed run already
+	// applied.
+	After time.Time
 }
 
 func (s LiveSimulator) Stream(ticks <-chan core.Tick) <-chan core.Tick {
@@ -17,6 +20,9 @@ func (s LiveSimulator) Stream(ticks <-chan core.Tick) <-chan core.Tick {
 		defer close(out)
 		var last *core.Tick
 		for tick := range ticks {
+			if !s.After.IsZero() && !tick.Timestamp.After(s.After) {
+				continue
+			}
 			if last != nil {
 				delta := tick.Timestamp.Sub(last.Timestamp)
 				if delta > 0 {
@@ -0,0 +1,192 @@
+package paper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/execution"
+)
+
+// DefaultTimeout bounds how long a request waits for the simulator's reply.
+const DefaultTimeout = 5 * time.Second
+
+// Broker is a paper-trading broker connected to an exchange simulator. It
+// implements execution.Broker, execution.MarketObserver and
+// execution.AccountReporter over the network protocol in Message.
+//
+// Requests return once the simulator has replied; order events are read
+// asynchronously and published on Events as they arrive. The simulator
+// sends a request's events before its reply, so they are already queued
+// when the request returns.
+type Broker struct {
+	Timeout time.Duration
+
+	conn    net.Conn
+	writeMu sync.Mutex
+	enc     *json.Encoder
+	queue   execution.EventQueue
+
+	mu      sync.Mutex
+	seq     int64
+	pending map[string]chan Message
+	err     error
+}
+
+// Dial connects to a simulator at addr.
+func Dial(addr string) (*Broker, error) {
+	conn, err := net.DialTimeout("tcp", addr, DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial exchange %s: %w", addr, err)
+	}
+	return NewBroker(conn), nil
+}
+
+// NewBroker speaks the paper protocol over an established connection.
+func NewBroker(conn net.Conn) *Broker {
+	b := &Broker{
+		Timeout: DefaultTimeout,
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		pending: map[string]chan Message{},
+	}
+	go b.readLoop()
+	return b
+}
+
+func (b *Broker) Close() error {
+	return b.conn.Close()
+}
+
+// OnTick forwards the bar to the simulator as market data.
+func (b *Broker) OnTick(tick core.Tick) {
+	if _, err := b.request(Message{Type: msgMarketData, Tick: &tick}); err != nil {
+		b.fail(err)
+	}
+}
+
+func (b *Broker) Submit(order core.Order) error {
+	_, err := b.request(Message{Type: msgNewOrder, Order: &order})
+	return err
+}
+
+func (b *Broker) Cancel(id string) error {
+	_, err := b.request(Message{Type: msgCancel, OrderID: id})
+	return err
+}
+
+func (b *Broker) Modify(id string, price, stopPrice float64, size int64) error {
+	_, err := b.request(Message{Type: msgModify, OrderID: id, Price: price, StopPrice: stopPrice, Size: size})
+	return err
+}
+
+// Positions asks the simulator for the account's net position.
+func (b *Broker) Positions() ([]core.AccountPosition, error) {
+	reply, err := b.request(Message{Type: msgPositions})
+	return reply.Positions, err
+}
+
+// OpenOrders asks the simulator for the account's working orders.
+func (b *Broker) OpenOrders() ([]core.Order, error) {
+	reply, err := b.request(Message{Type: msgOpenOrders})
+	return reply.Orders, err
+}
+
+func (b *Broker) Events() <-chan core.OrderEvent {
+	return b.queue.Events()
+}
+
+// Err reports the connection error that stopped the broker, if any.
+func (b *Broker) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *Broker) request(msg Message) (Message, error) {
+	b.mu.Lock()
+	if b.err != nil {
+		err := b.err
+		b.mu.Unlock()
+		return Message{}, err
+	}
+	b.seq++
+	msg.RequestID = fmt.Sprintf("REQ-%d", b.seq)
+	reply := make(chan Message, 1)
+	b.pending[msg.RequestID] = reply
+	b.mu.Unlock()
+
+	b.writeMu.Lock()
+	err := b.enc.Encode(msg)
+	b.writeMu.Unlock()
+	if err != nil {
+		b.fail(err)
+		return Message{}, err
+	}
+
+	timeout := b.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	select {
+	case resp, ok := <-reply:
+		if !ok {
+			return Message{}, b.Err()
+		}
+		if resp.Error != "" {
+			return resp, fmt.Errorf("exchange: %s", resp.Error)
+		}
+		return resp, nil
+	case <-time.After(timeout):
+		b.mu.Lock()
+		delete(b.pending, msg.RequestID)
+		b.mu.Unlock()
+		return Message{}, fmt.Errorf("exchange: %s %s timed out", msg.Type, msg.RequestID)
+	}
+}
+
+func (b *Broker) readLoop() {
+	scanner := bufio.NewScanner(b.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			b.fail(fmt.Errorf("exchange: bad message: %w", err))
+			return
+		}
+		if msg.Type == msgReply {
+			b.mu.Lock()
+			reply, ok := b.pending[msg.RequestID]
+			delete(b.pending, msg.RequestID)
+			b.mu.Unlock()
+			if ok {
+				reply <- msg
+			}
+			continue
+		}
+		if event, ok := msg.event(); ok {
+			b.queue.Publish(event)
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = fmt.Errorf("exchange: connection closed")
+	}
+	b.fail(err)
+}
+
+func (b *Broker) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+	for id, reply := range b.pending {
+		close(reply)
+		delete(b.pending, id)
+	}
+}
@@ -0,0 +1,87 @@
+package paper
+
+import (
+	"trading-algo-generator/internal/core"
+)
+
+// Message is one line of the paper-trading protocol: newline-delimited JSON
+// over TCP.
+//
+// Client requests are "new_order", "cancel", "modify" and "market_data",
+// plus the account queries "positions" and "open_orders". The simulator
+// answers every request with a final "reply" carrying the same RequestID
+// (and Error when it failed, or the query's Positions or Orders). Order events ("accepted",
+// "triggered", "partially_filled", "filled", "modified", "cancelled",
+// "expired", "rejected") may arrive at any time, before or after the reply
+// of the request that caused them.
+type Message struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
+	Order     *core.Order `json:"order,omitempty"`
+	OrderID   string      `json:"order_id,omitempty"`
+	Price     float64     `json:"price,omitempty"`
+	StopPrice float64     `json:"stop_price,omitempty"`
+	Size      int64       `json:"size,omitempty"`
+	Tick      *core.Tick  `json:"tick,omitempty"`
+	Fill      *core.Fill  `json:"fill,omitempty"`
+	Remaining int64       `json:"remaining,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+	Error     string      `json:"error,omitempty"`
+
+	Positions []core.AccountPosition `json:"positions,omitempty"`
+	Orders    []core.Order           `json:"orders,omitempty"`
+}
+
+const (
+	msgNewOrder   = "new_order"
+	msgCancel     = "cancel"
+	msgModify     = "modify"
+	msgMarketData = "market_data"
+	msgPositions  = "positions"
+	msgOpenOrders = "open_orders"
+	msgReply      = "reply"
+)
+
+var eventTypes = map[string]core.OrderEventType{}
+
+func init() {
+	for t := core.OrderAccepted; t <= core.OrderRejected; t++ {
+		eventTypes[t.String()] = t
+	}
+}
+
+func eventMessage(requestID string, event core.OrderEvent) Message {
+	order := event.Order
+	msg := Message{
+		Type:      event.Type.String(),
+		RequestID: requestID,
+		Order:     &order,
+		Remaining: event.Remaining,
+		Reason:    event.Reason,
+	}
+	if event.Fill.Size > 0 {
+		fill := event.Fill
+		msg.Fill = &fill
+	}
+	return msg
+}
+
+func (m Message) event() (core.OrderEvent, bool) {
+	eventType, ok := eventTypes[m.Type]
+	if !ok || m.Order == nil {
+		return core.OrderEvent{}, false
+	}
+	event := core.OrderEvent{
+		Type:      eventType,
+		Order:     *m.Order,
+		Remaining: m.Remaining,
+		Reason:    m.Reason,
+	}
+	if m.Fill != nil {
+		event.Fill = *m.Fill
+		event.Timestamp = m.Fill.Timestamp
+	} else {
+		event.Timestamp = m.Order.Timestamp
+	}
+	return event, true
+}
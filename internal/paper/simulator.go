@@ -0,0 +1,172 @@
+package paper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/execution"
+)
+
+// Simulator is a local exchange stand-in. Each connection gets its own
+// simulated account: market orders fill at the last market-data close,
+// other orders rest in an order book matched against incoming market data.
+// Order IDs are assigned by the client.
+type Simulator struct {
+	Costs execution.CostModel
+	Book  execution.BookSettings
+	// Calendar expires DAY orders at the end of each trade date.
+	Calendar *calendar.Calendar
+	Latency  time.Duration
+	Logger   *log.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// ListenAndServe accepts connections on addr until Close is called.
+func (s *Simulator) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener until Close is called.
+func (s *Simulator) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Addr is the listening address, once serving.
+func (s *Simulator) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Simulator) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Simulator) serveConn(conn net.Conn) {
+	defer conn.Close()
+	s.logf("session %s connected", conn.RemoteAddr())
+	account := &execution.MockBroker{Costs: s.Costs, Book: execution.OrderBook{Settings: s.Book, Calendar: s.Calendar}}
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var req Message
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			if err := enc.Encode(Message{Type: msgReply, Error: fmt.Sprintf("bad message: %v", err)}); err != nil {
+				return
+			}
+			continue
+		}
+		if s.Latency > 0 {
+			time.Sleep(s.Latency)
+		}
+		reply := Message{Type: msgReply, RequestID: req.RequestID}
+		events, err := s.handle(account, req, &reply)
+		for _, event := range events {
+			if err := enc.Encode(eventMessage(req.RequestID, event)); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			reply.Error = err.Error()
+		}
+		if err := enc.Encode(reply); err != nil {
+			return
+		}
+	}
+	s.logf("session %s closed", conn.RemoteAddr())
+}
+
+// handle applies one request to the account, returning the events it
+// caused. Query results go into reply.
+func (s *Simulator) handle(account *execution.MockBroker, req Message, reply *Message) ([]core.OrderEvent, error) {
+	var err error
+	switch req.Type {
+	case msgNewOrder:
+		if req.Order == nil {
+			return nil, fmt.Errorf("order required")
+		}
+		order := *req.Order
+		if order.Type == core.Market {
+			// Market orders fill at the simulator's own last price, not the
+			// client's.
+			market := account.Market()
+			if market.Timestamp.IsZero() {
+				return []core.OrderEvent{{Type: core.OrderRejected, Timestamp: order.Timestamp, Order: order, Remaining: order.Size, Reason: "no market data"}}, nil
+			}
+			order.Price = market.Close
+		}
+		err = account.Submit(order)
+	case msgCancel:
+		err = account.Cancel(req.OrderID)
+	case msgModify:
+		err = account.Modify(req.OrderID, req.Price, req.StopPrice, req.Size)
+	case msgMarketData:
+		if req.Tick == nil {
+			return nil, fmt.Errorf("tick required")
+		}
+		account.OnTick(*req.Tick)
+	case msgPositions:
+		reply.Positions, err = account.Positions()
+	case msgOpenOrders:
+		reply.Orders, err = account.OpenOrders()
+	default:
+		return nil, fmt.Errorf("unknown message type %q", req.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return drain(account), nil
+}
+
+func drain(account *execution.MockBroker) []core.OrderEvent {
+	var drained []core.OrderEvent
+	for {
+		select {
+		case event := <-account.Events():
+			drained = append(drained, event)
+		default:
+			return drained
+		}
+	}
+}
+
+func (s *Simulator) logf(format string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
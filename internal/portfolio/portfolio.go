@@ -0,0 +1,389 @@
+// Package portfolio runs several strategies side by side on one tick
+// stream and one account, and reports their equity curves together.
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/contracts"
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/eval"
+	"trading-algo-generator/internal/execution"
+)
+
+// Policy decides how the strategies' positions reach the account.
+type Policy int
+
+const (
+	// Segregated gives each strategy its own position and fills.
+	Segregated Policy = iota
+	// Netted trades only the account's net position per symbol: the
+	// strategies keep cost-free virtual positions and the account trades the
+	// net change at the bar's close, paying costs on it. The account's PnL
+	// comes from those fills, so it differs from the strategies' PnL by the
+	// costs and by the gap between their fill prices and the close.
+	Netted
+)
+
+func (p Policy) String() string {
+	if p == Netted {
+		return "netted"
+	}
+	return "segregated"
+}
+
+// ParsePolicy parses a config position policy; empty means segregated.
+func ParsePolicy(value string) (Policy, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "segregated", "segregate":
+		return Segregated, nil
+	case "netted", "net":
+		return Netted, nil
+	default:
+		return Segregated, fmt.Errorf("unknown position policy %q (want segregated or netted)", value)
+	}
+}
+
+// Strategy is one member of the portfolio. Capital is its allocation of the
+// portfolio's starting equity, used to turn its daily PnL into returns.
+type Strategy struct {
+	Name    string
+	Capital float64
+	Router  *core.Router
+}
+
+// Runner feeds every tick to every strategy in order, so runs stay
+// deterministic, and marks the portfolio at the end of each trade date.
+type Runner struct {
+	Strategies []Strategy
+	Policy     Policy
+	// Calendar decides trade dates; nil uses the tick's calendar date.
+	Calendar *calendar.Calendar
+
+	books    map[string]*netBook
+	held     map[*core.Engine]int64
+	traded   int64
+	day      time.Time
+	dates    []time.Time
+	equity   [][]float64
+	combined []float64
+}
+
+// netBook is the account's net position in one symbol under Netted, its
+// average price and PnL, and the costs of trading it. Qty is signed.
+type netBook struct {
+	contract contracts.Spec
+	costs    execution.CostModel
+	qty      int64
+	avgPrice float64
+	realized float64
+	mark     float64
+	costPaid float64
+	traded   int64
+}
+
+// AddBook registers the contract and costs the account trades a symbol's
+// net position with. Netted runs need one per traded symbol.
+func (r *Runner) AddBook(symbol string, contract contracts.Spec, costs execution.CostModel) {
+	if r.books == nil {
+		r.books = map[string]*netBook{}
+	}
+	symbol = strings.ToUpper(symbol)
+	if _, ok := r.books[symbol]; !ok {
+		r.books[symbol] = &netBook{contract: contract, costs: costs}
+	}
+}
+
+// OnTick applies a tick to every strategy trading its symbol, then nets
+// their positions into the account under Netted.
+func (r *Runner) OnTick(tick core.Tick) error {
+	if day := r.tradeDate(tick.Timestamp); !day.Equal(r.day) {
+		if !r.day.IsZero() {
+			r.closeDay()
+		}
+		r.day = day
+	}
+	for _, strategy := range r.Strategies {
+		if err := strategy.Router.OnTick(tick); err != nil {
+			return fmt.Errorf("%s: %w", strategy.Name, err)
+		}
+	}
+	return r.rebalance(tick)
+}
+
+// Flush closes every open position and marks the last trade date.
+func (r *Runner) Flush(reason string) error {
+	for _, strategy := range r.Strategies {
+		if err := strategy.Router.Flush(reason); err != nil {
+			return fmt.Errorf("%s: %w", strategy.Name, err)
+		}
+	}
+	for symbol := range r.books {
+		if err := r.rebalance(r.lastTick(symbol)); err != nil {
+			return err
+		}
+	}
+	if !r.day.IsZero() {
+		r.closeDay()
+		r.day = time.Time{}
+	}
+	return nil
+}
+
+// lastTick is the last bar any strategy saw for symbol.
+func (r *Runner) lastTick(symbol string) core.Tick {
+	tick := core.Tick{Symbol: symbol}
+	for _, strategy := range r.Strategies {
+		if engine := strategy.Router.Engine(symbol); engine != nil && engine.LastBar().After(tick.Timestamp) {
+			tick.Timestamp = engine.LastBar()
+			tick.Close = engine.LastClose()
+		}
+	}
+	return tick
+}
+
+// rebalance trades the account toward the strategies' net position in the
+// tick's symbol at its close, and counts the contracts they traded. A
+// strategy that enters and exits within one bar never reaches the account.
+func (r *Runner) rebalance(tick core.Tick) error {
+	if r.Policy != Netted {
+		return nil
+	}
+	var target int64
+	for _, strategy := range r.Strategies {
+		engine := strategy.Router.Engine(tick.Symbol)
+		if engine == nil {
+			continue
+		}
+		signed := signedSize(engine.Position)
+		if r.held == nil {
+			r.held = map[*core.Engine]int64{}
+		}
+		r.traded += abs(signed - r.held[engine])
+		r.held[engine] = signed
+		target += signed
+	}
+	symbol := strings.ToUpper(tick.Symbol)
+	book, ok := r.books[symbol]
+	if !ok {
+		if target == 0 {
+			return nil
+		}
+		return fmt.Errorf("no net book for symbol %s", symbol)
+	}
+	book.fill(target, tick)
+	return nil
+}
+
+// fill moves the book to target contracts at the tick's close, paying
+// commission, fees and slippage on the change. Contracts that reduce the
+// position realize their PnL against the average price; the rest open at
+// the close.
+func (b *netBook) fill(target int64, tick core.Tick) {
+	if tick.Close != 0 {
+		b.mark = tick.Close
+	}
+	delta := target - b.qty
+	if delta == 0 {
+		return
+	}
+	order := core.Order{Direction: core.Long, Size: abs(delta), Type: core.Market, Price: tick.Close, Timestamp: tick.Timestamp}
+	if delta < 0 {
+		order.Direction = core.Short
+	}
+	commission, fees := b.costs.Fees(order.Size)
+	b.costPaid += commission + fees + b.contract.Value(b.costs.Slippage(order, tick), order.Size)
+	b.traded += order.Size
+
+	if b.qty != 0 && (b.qty > 0) != (delta > 0) {
+		closed := min(abs(delta), abs(b.qty))
+		move := tick.Close - b.avgPrice
+		if b.qty < 0 {
+			move = -move
+		}
+		b.realized += b.contract.Value(move, closed)
+	}
+	switch {
+	case target == 0:
+		b.avgPrice = 0
+	case b.qty == 0 || (b.qty > 0) != (target > 0):
+		b.avgPrice = tick.Close
+	case abs(target) > abs(b.qty):
+		b.avgPrice = (b.avgPrice*float64(abs(b.qty)) + tick.Close*float64(abs(delta))) / float64(abs(target))
+	}
+	b.qty = target
+}
+
+// unrealized is the open position's PnL at the last close seen.
+func (b *netBook) unrealized() float64 {
+	return b.contract.Value(b.mark-b.avgPrice, b.qty)
+}
+
+// equity is the book's realized and unrealized PnL less its costs.
+func (b *netBook) equity() float64 {
+	return b.realized + b.unrealized() - b.costPaid
+}
+
+// closeDay records each strategy's and the account's equity for the
+// trade date that just ended.
+func (r *Runner) closeDay() {
+	if r.equity == nil {
+		r.equity = make([][]float64, len(r.Strategies))
+	}
+	var combined float64
+	for i, strategy := range r.Strategies {
+		equity := strategy.Router.Equity()
+		r.equity[i] = append(r.equity[i], equity)
+		if r.Policy != Netted {
+			combined += equity
+		}
+	}
+	if r.Policy == Netted {
+		for _, book := range r.books {
+			combined += book.equity()
+		}
+	}
+	r.dates = append(r.dates, r.day)
+	r.combined = append(r.combined, combined)
+}
+
+func (r *Runner) tradeDate(ts time.Time) time.Time {
+	if r.Calendar != nil {
+		return r.Calendar.TradeDate(ts)
+	}
+	return time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+}
+
+// Report is a finished portfolio run.
+type Report struct {
+	Policy Policy
+	Names  []string
+	// Summaries are each strategy's own results; under Netted they are
+	// before costs.
+	Summaries []eval.Summary
+	// Combined merges every strategy's trades.
+	Combined eval.Summary
+	// Dates are the trade dates marked; Equity holds each strategy's
+	// cumulative net PnL at the end of each, and AccountEquity the
+	// account's: the strategies' sum, or under Netted the net books'
+	// realized and unrealized PnL less their costs.
+	Dates         []time.Time
+	Equity        [][]float64
+	AccountEquity []float64
+	// Returns are daily PnL over each strategy's Capital (or raw daily PnL
+	// when it has none), and Correlation their pairwise Pearson
+	// correlation, NaN where undefined.
+	Returns     [][]float64
+	Correlation [][]float64
+	// Contracts is what the account traded under Netted, StrategyContracts
+	// what the strategies traded between them. NetRealized and
+	// NetUnrealized are the net books' PnL before NetCosts.
+	Contracts         int64
+	StrategyContracts int64
+	NetRealized       float64
+	NetUnrealized     float64
+	NetCosts          float64
+}
+
+// Report summarizes the run so far.
+func (r *Runner) Report() Report {
+	report := Report{
+		Policy:        r.Policy,
+		Dates:         r.dates,
+		Equity:        r.equity,
+		AccountEquity: r.combined,
+	}
+	evaluators := make([]*eval.Evaluator, 0, len(r.Strategies))
+	for i, strategy := range r.Strategies {
+		report.Names = append(report.Names, strategy.Name)
+		report.Summaries = append(report.Summaries, strategy.Router.Summary())
+		evaluators = append(evaluators, strategy.Router.Evaluators()...)
+		var curve []float64
+		if i < len(r.equity) {
+			curve = r.equity[i]
+		}
+		report.Returns = append(report.Returns, dailyReturns(curve, strategy.Capital))
+	}
+	report.Combined = eval.Merge(evaluators...).Summary()
+	report.Correlation = correlationMatrix(report.Returns)
+	report.StrategyContracts = r.traded
+	for _, book := range r.books {
+		report.Contracts += book.traded
+		report.NetRealized += book.realized
+		report.NetUnrealized += book.unrealized()
+		report.NetCosts += book.costPaid
+	}
+	return report
+}
+
+// dailyReturns turns a cumulative equity curve into each day's change,
+// over capital when it is set.
+func dailyReturns(curve []float64, capital float64) []float64 {
+	returns := make([]float64, len(curve))
+	var prev float64
+	for i, equity := range curve {
+		returns[i] = equity - prev
+		if capital > 0 {
+			returns[i] /= capital
+		}
+		prev = equity
+	}
+	return returns
+}
+
+func correlationMatrix(series [][]float64) [][]float64 {
+	matrix := make([][]float64, len(series))
+	for i := range series {
+		matrix[i] = make([]float64, len(series))
+		for j := range series {
+			matrix[i][j] = correlation(series[i], series[j])
+		}
+	}
+	return matrix
+}
+
+// correlation is the Pearson correlation of two equal-length series.
+func correlation(a, b []float64) float64 {
+	n := len(a)
+	if n < 2 || len(b) != n {
+		return math.NaN()
+	}
+	var meanA, meanB float64
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(n)
+	meanB /= float64(n)
+	var cov, varA, varB float64
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+func signedSize(position core.Position) int64 {
+	if !position.Open {
+		return 0
+	}
+	if position.Direction == core.Short {
+		return -position.Size
+	}
+	return position.Size
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,180 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/core"
+)
+
+// Rules and entry block reasons for account-wide limits.
+const (
+	RuleAccountDailyStop  = "account_daily_stop"
+	RuleAccountWeeklyStop = "account_weekly_stop"
+	RuleAccountDrawdown   = "account_drawdown"
+	BlockAccountTrades    = "account_max_trades"
+	BlockAccountPositions = "account_positions"
+	BlockAccountContracts = "account_contracts"
+)
+
+// AccountSettings are limits across everything an account trades, on top
+// of each engine's own Settings. Zero values disable each limit.
+type AccountSettings struct {
+	DailyStopLoss  float64
+	WeeklyStopLoss float64
+	// MaxDrawdown halts entries on every engine once combined intraday
+	// equity falls this far below the day's high-water mark.
+	MaxDrawdown    float64
+	MaxDailyTrades int
+	// MaxOpenPositions caps how many engines (symbols, or strategy and
+	// symbol pairs) hold a position at once and MaxContracts the contracts
+	// held across all of them.
+	MaxOpenPositions int
+	MaxContracts     int64
+}
+
+// Account enforces AccountSettings across the engines of a multi-symbol or
+// multi-strategy run. Each engine reports its trades and marks its position
+// to it, identified by its own Manager.
+type Account struct {
+	Settings AccountSettings
+	// Calendar decides when a new trading day starts; nil resets at
+	// midnight in the tick's time zone.
+	Calendar       *calendar.Calendar
+	DailyPnL       float64
+	WeeklyPnL      float64
+	DailyTrades    int
+	DailyPeak      float64
+	LastSessionDay time.Time
+	Halted         bool
+	HaltReason     string
+
+	positions  map[*Manager]int64
+	unrealized map[*Manager]float64
+	triggers   []Trigger
+}
+
+// ResetIfNewSession clears the daily counters and halt on a new trade
+// date, and the weekly PnL on a new ISO week.
+func (a *Account) ResetIfNewSession(ts time.Time) {
+	sessionDay := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+	if a.Calendar != nil {
+		sessionDay = a.Calendar.TradeDate(ts)
+	}
+	if !a.LastSessionDay.IsZero() && sessionDay.Equal(a.LastSessionDay) {
+		return
+	}
+	week, _ := periodKeys(sessionDay)
+	if lastWeek, _ := periodKeys(a.LastSessionDay); a.LastSessionDay.IsZero() || week != lastWeek {
+		a.WeeklyPnL = 0
+	}
+	a.DailyPnL = 0
+	a.DailyTrades = 0
+	a.DailyPeak = 0
+	a.Halted = false
+	a.HaltReason = ""
+	a.LastSessionDay = sessionDay
+	a.checkWeeklyLimit(ts)
+}
+
+// EntryBlock is why the engine managed by m cannot grow its position to
+// size contracts, or "" when it can.
+func (a *Account) EntryBlock(m *Manager, size int64) string {
+	if a.Halted {
+		return a.HaltReason
+	}
+	held := a.positions[m]
+	if held == 0 && a.Settings.MaxDailyTrades > 0 && a.DailyTrades >= a.Settings.MaxDailyTrades {
+		return BlockAccountTrades
+	}
+	var open int
+	var contracts int64
+	for other, n := range a.positions {
+		if other == m || n == 0 {
+			continue
+		}
+		open++
+		contracts += n
+	}
+	if a.Settings.MaxOpenPositions > 0 && open+1 > a.Settings.MaxOpenPositions {
+		return BlockAccountPositions
+	}
+	if a.Settings.MaxContracts > 0 && contracts+size > a.Settings.MaxContracts {
+		return BlockAccountContracts
+	}
+	return ""
+}
+
+// RecordEntry counts a position opened by any engine toward MaxDailyTrades.
+func (a *Account) RecordEntry() {
+	a.DailyTrades++
+}
+
+// RecordTrade books a closed trade's net PnL against the daily and weekly
+// limits.
+func (a *Account) RecordTrade(ts time.Time, pnl float64) {
+	a.DailyPnL += pnl
+	a.WeeklyPnL += pnl
+	if a.Settings.DailyStopLoss < 0 && a.DailyPnL <= a.Settings.DailyStopLoss {
+		a.halt(ts, RuleAccountDailyStop, fmt.Sprintf("account daily PnL %.2f at or below %.2f", a.DailyPnL, a.Settings.DailyStopLoss))
+	}
+	a.checkWeeklyLimit(ts)
+}
+
+func (a *Account) checkWeeklyLimit(ts time.Time) {
+	if a.Settings.WeeklyStopLoss < 0 && a.WeeklyPnL <= a.Settings.WeeklyStopLoss {
+		a.halt(ts, RuleAccountWeeklyStop, fmt.Sprintf("account weekly PnL %.2f at or below %.2f", a.WeeklyPnL, a.Settings.WeeklyStopLoss))
+	}
+}
+
+// Reserve counts size contracts toward the engine's holding as soon as its
+// entry is sent, so engines later in the same bar see it.
+func (a *Account) Reserve(m *Manager, size int64) {
+	if a.positions == nil {
+		a.positions = map[*Manager]int64{}
+	}
+	if size > a.positions[m] {
+		a.positions[m] = size
+	}
+}
+
+// MarkToMarket records the position of the engine managed by m at the
+// bar's close, plus pending contracts of its working entry, and checks
+// combined intraday equity against MaxDrawdown.
+func (a *Account) MarkToMarket(m *Manager, position core.Position, pending int64, tick core.Tick) {
+	if a.positions == nil {
+		a.positions = map[*Manager]int64{}
+	}
+	if a.unrealized == nil {
+		a.unrealized = map[*Manager]float64{}
+	}
+	a.positions[m] = position.Size + pending
+	a.unrealized[m] = m.unrealized(position, tick.Close)
+	equity := a.DailyPnL
+	for _, pnl := range a.unrealized {
+		equity += pnl
+	}
+	if equity > a.DailyPeak {
+		a.DailyPeak = equity
+	}
+	if drawdown := a.DailyPeak - equity; a.Settings.MaxDrawdown > 0 && drawdown >= a.Settings.MaxDrawdown {
+		a.halt(tick.Timestamp, RuleAccountDrawdown, fmt.Sprintf("account intraday equity %.2f is %.2f below its high of %.2f", equity, drawdown, a.DailyPeak))
+	}
+}
+
+// TakeTriggers returns the account rules triggered since the last call.
+func (a *Account) TakeTriggers() []Trigger {
+	triggers := a.triggers
+	a.triggers = nil
+	return triggers
+}
+
+func (a *Account) halt(ts time.Time, rule, detail string) {
+	if a.Halted && a.HaltReason == rule {
+		return
+	}
+	a.Halted = true
+	a.HaltReason = rule
+	a.triggers = append(a.triggers, Trigger{Time: ts, Rule: rule, Detail: detail})
+}
@@ -0,0 +1,100 @@
+package risk
+
+import (
+	"sort"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/core"
+)
+
+// ReasonEvent is the exit reason for positions flattened, or stops
+// tightened, around an economic event.
+const ReasonEvent = "event"
+
+// EventSettings are blackout rules around scheduled economic events, read
+// from File (see calendar.LoadEvents). Events below MinImportance (low,
+// medium or high; default all) are ignored. Zero values disable each rule.
+type EventSettings struct {
+	File          string
+	MinImportance string
+	// BeforeMinutes and AfterMinutes bound the blackout window around each
+	// event, in which new entries are blocked.
+	BeforeMinutes int
+	AfterMinutes  int
+	// TightenStopTicks pulls every open lot's stop to within this many
+	// ticks of the close while a blackout window is in force.
+	TightenStopTicks int64
+	// FlattenBeforeMinutes closes every position this many minutes before
+	// an event.
+	FlattenBeforeMinutes int
+}
+
+// Validate checks MinImportance.
+func (s EventSettings) Validate() error {
+	_, err := s.minImportance()
+	return err
+}
+
+func (s EventSettings) minImportance() (calendar.Importance, error) {
+	if s.MinImportance == "" {
+		return calendar.Low, nil
+	}
+	return calendar.ParseImportance(s.MinImportance)
+}
+
+// eventWithin returns the first event that counts at ts, with before and
+// after the window around each event.
+func (m *Manager) eventWithin(ts time.Time, before, after time.Duration) (calendar.Event, bool) {
+	threshold, err := m.Settings.Events.minImportance()
+	if err != nil {
+		return calendar.Event{}, false
+	}
+	// Events are sorted; skip those whose window ended before ts.
+	i := sort.Search(len(m.Events), func(i int) bool { return !m.Events[i].Time.Add(after).Before(ts) })
+	for ; i < len(m.Events) && !m.Events[i].Time.Add(-before).After(ts); i++ {
+		event := m.Events[i]
+		if event.Importance < threshold {
+			continue
+		}
+		if !ts.Before(event.Time.Add(-before)) && !ts.After(event.Time.Add(after)) {
+			return event, true
+		}
+	}
+	return calendar.Event{}, false
+}
+
+// InBlackout reports the event whose blackout window covers ts.
+func (m *Manager) InBlackout(ts time.Time) (calendar.Event, bool) {
+	settings := m.Settings.Events
+	if settings.BeforeMinutes <= 0 && settings.AfterMinutes <= 0 {
+		return calendar.Event{}, false
+	}
+	return m.eventWithin(ts, minutes(settings.BeforeMinutes), minutes(settings.AfterMinutes))
+}
+
+// eventFlattenDue reports whether an event is due within the flatten
+// window. Positions stay flat until the event is out.
+func (m *Manager) eventFlattenDue(ts time.Time) bool {
+	if m.Settings.Events.FlattenBeforeMinutes <= 0 {
+		return false
+	}
+	event, ok := m.eventWithin(ts, minutes(m.Settings.Events.FlattenBeforeMinutes), 0)
+	return ok && ts.Before(event.Time)
+}
+
+// tightenForEvents pulls a lot's stop toward the close inside a blackout.
+func (m *Manager) tightenForEvents(direction core.Direction, lot *core.Lot, tick core.Tick) {
+	if m.Settings.Events.TightenStopTicks <= 0 {
+		return
+	}
+	if _, ok := m.InBlackout(tick.Timestamp); !ok {
+		return
+	}
+	distance := float64(m.Settings.Events.TightenStopTicks) * m.tickSize()
+	candidate := tick.Close - distance
+	if direction == core.Short {
+		candidate = tick.Close + distance
+	}
+	raiseStop(direction, lot, candidate, ReasonEvent)
+}
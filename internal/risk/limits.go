@@ -0,0 +1,150 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"trading-algo-generator/internal/core"
+)
+
+// Rules reported when they trigger, also used as entry block reasons.
+const (
+	RuleDailyStop   = "daily_stop"
+	RuleWeeklyStop  = "weekly_stop"
+	RuleMonthlyStop = "monthly_stop"
+	RuleDrawdown    = "drawdown"
+	RuleCooldown    = "cooldown"
+	// ReasonMaxLoss is the stop reason for the per-trade dollar loss cap.
+	ReasonMaxLoss = "max_loss"
+)
+
+// Trigger is a risk rule firing: a halt, a cooldown or a period limit.
+type Trigger struct {
+	Time   time.Time
+	Rule   string
+	Detail string
+}
+
+// Halt stops new entries until the rule's period rolls over (daily halts
+// clear on the next trade date) and reports it.
+func (m *Manager) Halt(ts time.Time, rule, detail string) {
+	if m.Halted && m.HaltReason == rule {
+		return
+	}
+	m.Halted = true
+	m.HaltReason = rule
+	m.report(ts, rule, detail)
+}
+
+// TakeTriggers returns the rules triggered since the last call.
+func (m *Manager) TakeTriggers() []Trigger {
+	triggers := m.triggers
+	m.triggers = nil
+	return triggers
+}
+
+func (m *Manager) report(ts time.Time, rule, detail string) {
+	m.triggers = append(m.triggers, Trigger{Time: ts, Rule: rule, Detail: detail})
+}
+
+// RecordTrade books a closed trade's net PnL against the daily, weekly
+// and monthly limits and the consecutive-loss cooldown.
+func (m *Manager) RecordTrade(ts time.Time, pnl float64) {
+	m.DailyPnL += pnl
+	m.WeeklyPnL += pnl
+	m.MonthlyPnL += pnl
+	if m.Settings.DailyStopLoss < 0 && m.DailyPnL <= m.Settings.DailyStopLoss {
+		m.Halt(ts, RuleDailyStop, fmt.Sprintf("daily PnL %.2f at or below %.2f", m.DailyPnL, m.Settings.DailyStopLoss))
+	}
+	m.checkPeriodLimits(ts)
+
+	if pnl >= 0 {
+		m.ConsecutiveLosses = 0
+		return
+	}
+	m.ConsecutiveLosses++
+	if m.Settings.CooldownLosses > 0 && m.ConsecutiveLosses >= m.Settings.CooldownLosses && m.Settings.CooldownMinutes > 0 {
+		m.CooldownUntil = ts.Add(minutes(m.Settings.CooldownMinutes))
+		m.report(ts, RuleCooldown, fmt.Sprintf("%d consecutive losses; no entries until %s", m.ConsecutiveLosses, m.CooldownUntil.Format(time.RFC3339)))
+		m.ConsecutiveLosses = 0
+	}
+}
+
+// checkPeriodLimits halts while the week's or month's loss limit is
+// crossed.
+func (m *Manager) checkPeriodLimits(ts time.Time) {
+	if m.Settings.WeeklyStopLoss < 0 && m.WeeklyPnL <= m.Settings.WeeklyStopLoss {
+		m.Halt(ts, RuleWeeklyStop, fmt.Sprintf("weekly PnL %.2f at or below %.2f", m.WeeklyPnL, m.Settings.WeeklyStopLoss))
+		return
+	}
+	if m.Settings.MonthlyStopLoss < 0 && m.MonthlyPnL <= m.Settings.MonthlyStopLoss {
+		m.Halt(ts, RuleMonthlyStop, fmt.Sprintf("monthly PnL %.2f at or below %.2f", m.MonthlyPnL, m.Settings.MonthlyStopLoss))
+	}
+}
+
+// MarkToMarket tracks intraday equity (the day's realized PnL plus the
+// open position at the bar's close) against its high-water mark and halts
+// when the drawdown from it reaches MaxDrawdown, or MaxDrawdownPct percent
+// of the peak.
+func (m *Manager) MarkToMarket(position core.Position, tick core.Tick) {
+	equity := m.DailyPnL + m.unrealized(position, tick.Close)
+	if equity > m.DailyPeak {
+		m.DailyPeak = equity
+	}
+	drawdown := m.DailyPeak - equity
+	if drawdown <= 0 {
+		return
+	}
+	detail := fmt.Sprintf("intraday equity %.2f is %.2f below its high of %.2f", equity, drawdown, m.DailyPeak)
+	if m.Settings.MaxDrawdown > 0 && drawdown >= m.Settings.MaxDrawdown {
+		m.Halt(tick.Timestamp, RuleDrawdown, detail)
+		return
+	}
+	if m.Settings.MaxDrawdownPct > 0 && m.DailyPeak > 0 && drawdown/m.DailyPeak*100 >= m.Settings.MaxDrawdownPct {
+		m.Halt(tick.Timestamp, RuleDrawdown, detail)
+	}
+}
+
+func (m *Manager) unrealized(position core.Position, price float64) float64 {
+	if !position.Open {
+		return 0
+	}
+	var pnl float64
+	for _, lot := range position.Lots {
+		move := price - lot.EntryPrice
+		if position.Direction == core.Short {
+			move = -move
+		}
+		pnl += m.Contract.Value(move, lot.Size)
+	}
+	return pnl
+}
+
+// inCooldown reports whether a consecutive-loss pause is in force at ts.
+func (m *Manager) inCooldown(ts time.Time) bool {
+	return !m.CooldownUntil.IsZero() && ts.Before(m.CooldownUntil)
+}
+
+// maxLossStop is the stop that caps a lot's loss at MaxTradeLoss, rounded
+// to a whole number of ticks, or 0 when the cap is off.
+func (m *Manager) maxLossStop(direction core.Direction, lot *core.Lot) float64 {
+	if m.Settings.MaxTradeLoss <= 0 || lot.Size <= 0 {
+		return 0
+	}
+	tickSize := m.tickSize()
+	perTick := m.Contract.Value(tickSize, lot.Size)
+	if perTick <= 0 {
+		return 0
+	}
+	ticks := int64(m.Settings.MaxTradeLoss / perTick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	return stopFromEntry(direction, lot, ticks, tickSize)
+}
+
+// periodKeys identify the week (ISO) and month a trade date falls in.
+func periodKeys(date time.Time) (int, int) {
+	year, week := date.ISOWeek()
+	return year*100 + week, date.Year()*100 + int(date.Month())
+}
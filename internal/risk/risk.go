@@ -3,137 +3,364 @@ package risk
 import (
 	"time"
 
+	"trading-algo-generator/internal/calendar"
+	"trading-algo-generator/internal/contracts"
 	"trading-algo-generator/internal/core"
 )
 
-// Settings define risk limits and stop logic.
+// Settings define risk limits and stop logic. Loss limits are in account
+// currency; stop distances are in ticks of the traded contract.
 type Settings struct {
-	DailyStopLoss    float64
+	DailyStopLoss     float64
 	PerTradeStopTicks int64
-	BreakevenTicks   int64
-	BreakevenPlus    int64
-	TrailingTicks    int64
-	TickSize         float64
-	MaxDailyTrades   int
+	TargetTicks       int64
+	BreakevenTicks    int64
+	BreakevenPlus     int64
+	TrailingTicks     int64
+	TickSize          float64
+	MaxDailyTrades    int
+	MaxPositionSize   int64
+	// WeeklyStopLoss and MonthlyStopLoss halt entries for the rest of the
+	// ISO week or calendar month (of trade dates) once crossed.
+	WeeklyStopLoss  float64
+	MonthlyStopLoss float64
+	// MaxDrawdown halts entries once intraday equity falls this far below
+	// the day's high-water mark; MaxDrawdownPct does so at that percentage
+	// of the peak.
+	MaxDrawdown    float64
+	MaxDrawdownPct float64
+	// CooldownLosses consecutive losing trades pause entries for
+	// CooldownMinutes.
+	CooldownLosses  int
+	CooldownMinutes int
+	// MaxTradeLoss caps each lot's loss in account currency by tightening
+	// its initial stop.
+	MaxTradeLoss float64
+	// Volatility sizes stops from an ATR or realized-volatility measure.
+	Volatility VolatilitySettings
+	Session    SessionSettings
+	Events     EventSettings
 }
 
 // Manager enforces risk rules and updates stops.
 type Manager struct {
-	Settings       Settings
+	Settings Settings
+	Contract contracts.Spec
+	// Calendar decides when a new trading day starts; nil resets at
+	// midnight in the tick's time zone.
+	Calendar *calendar.Calendar
+	// Events is the economic calendar for the Events rules, sorted by time.
+	Events         []calendar.Event
 	DailyPnL       float64
 	DailyTrades    int
 	LastSessionDay time.Time
 	Halted         bool
+
+	// HaltReason is the rule that halted entries.
+	HaltReason        string
+	DailyPeak         float64
+	WeeklyPnL         float64
+	MonthlyPnL        float64
+	ConsecutiveLosses int
+	CooldownUntil     time.Time
+
+	rules      *sessionRules
+	triggers   []Trigger
+	volatility VolatilityState
 }
 
+// State is the manager's running state, checkpointed so a restarted engine
+// keeps counting toward the same limits.
+type State struct {
+	DailyPnL       float64
+	DailyTrades    int
+	LastSessionDay time.Time
+	Halted         bool
+
+	HaltReason        string
+	DailyPeak         float64
+	WeeklyPnL         float64
+	MonthlyPnL        float64
+	ConsecutiveLosses int
+	CooldownUntil     time.Time
+	Volatility        VolatilityState
+}
+
+func (m *Manager) State() State {
+	return State{
+		DailyPnL:          m.DailyPnL,
+		DailyTrades:       m.DailyTrades,
+		LastSessionDay:    m.LastSessionDay,
+		Halted:            m.Halted,
+		HaltReason:        m.HaltReason,
+		DailyPeak:         m.DailyPeak,
+		WeeklyPnL:         m.WeeklyPnL,
+		MonthlyPnL:        m.MonthlyPnL,
+		ConsecutiveLosses: m.ConsecutiveLosses,
+		CooldownUntil:     m.CooldownUntil,
+		Volatility:        m.volatility,
+	}
+}
+
+func (m *Manager) Restore(state State) {
+	m.DailyPnL = state.DailyPnL
+	m.DailyTrades = state.DailyTrades
+	m.LastSessionDay = state.LastSessionDay
+	m.Halted = state.Halted
+	m.HaltReason = state.HaltReason
+	m.DailyPeak = state.DailyPeak
+	m.WeeklyPnL = state.WeeklyPnL
+	m.MonthlyPnL = state.MonthlyPnL
+	m.ConsecutiveLosses = state.ConsecutiveLosses
+	m.CooldownUntil = state.CooldownUntil
+	m.volatility = state.Volatility
+}
+
+// ResetIfNewSession clears the daily counters and halt when the tick
+// belongs to a new trade date, and the weekly and monthly PnL when it
+// starts a new week or month. A crossed weekly or monthly limit halts the
+// new day again.
 func (m *Manager) ResetIfNewSession(tick core.Tick) {
 	sessionDay := time.Date(tick.Timestamp.Year(), tick.Timestamp.Month(), tick.Timestamp.Day(), 0, 0, 0, 0, tick.Timestamp.Location())
+	if m.Calendar != nil {
+		sessionDay = m.Calendar.TradeDate(tick.Timestamp)
+	}
 	if m.LastSessionDay.IsZero() || !sessionDay.Equal(m.LastSessionDay) {
+		week, month := periodKeys(sessionDay)
+		lastWeek, lastMonth := periodKeys(m.LastSessionDay)
+		if m.LastSessionDay.IsZero() || week != lastWeek {
+			m.WeeklyPnL = 0
+		}
+		if m.LastSessionDay.IsZero() || month != lastMonth {
+			m.MonthlyPnL = 0
+		}
 		m.DailyPnL = 0
 		m.DailyTrades = 0
+		m.DailyPeak = 0
 		m.Halted = false
+		m.HaltReason = ""
 		m.LastSessionDay = sessionDay
+		m.checkPeriodLimits(tick.Timestamp)
 	}
 }
 
-// AllowEntry checks if a new trade can be opened.
-func (m *Manager) AllowEntry() bool {
+// Reasons an entry is blocked, besides the halting rule.
+const (
+	BlockHalted    = "halted"
+	BlockMaxTrades = "max_trades"
+	BlockSession   = "session"
+	BlockEvent     = "event"
+)
+
+// AllowEntry checks if a new trade can be opened at ts.
+func (m *Manager) AllowEntry(ts time.Time) bool {
+	return m.EntryBlock(ts) == ""
+}
+
+// EntryBlock is why a new trade cannot be opened at ts, or "" when it can.
+func (m *Manager) EntryBlock(ts time.Time) string {
 	if m.Halted {
-		return false
+		if m.HaltReason != "" {
+			return m.HaltReason
+		}
+		return BlockHalted
 	}
 	if m.Settings.MaxDailyTrades > 0 && m.DailyTrades >= m.Settings.MaxDailyTrades {
-		return false
+		return BlockMaxTrades
 	}
-	return true
+	if m.inCooldown(ts) {
+		return RuleCooldown
+	}
+	if _, ok := m.InBlackout(ts); ok {
+		return BlockEvent
+	}
+	if reason, due := m.FlattenDue(ts); due {
+		if reason == ReasonEvent {
+			return BlockEvent
+		}
+		return BlockSession
+	}
+	if !m.entryWindowOpen(ts) {
+		return BlockSession
+	}
+	return ""
 }
 
-// UpdateStops modifies position stop price based on BE+1 and trailing rules.
+// UpdateStops modifies each lot's stop price based on BE+1 and trailing
+// rules. Lots filled during this bar first ratchet on the next one.
 func (m *Manager) UpdateStops(position *core.Position, tick core.Tick) {
 	if !position.Open {
 		return
 	}
-	moveTicks := ticksMoved(position, tick, m.Settings.TickSize)
-	if moveTicks > position.MaxFavorableTicks {
-		position.MaxFavorableTicks = moveTicks
+	for i := range position.Lots {
+		if !position.Lots[i].EntryTime.Before(tick.Timestamp) {
+			continue
+		}
+		m.updateLotStop(position.Direction, &position.Lots[i], tick)
+		m.tightenForEvents(position.Direction, &position.Lots[i], tick)
+	}
+}
+
+func (m *Manager) updateLotStop(direction core.Direction, lot *core.Lot, tick core.Tick) {
+	tickSize := m.tickSize()
+	moveTicks := ticksMoved(direction, lot, tick, tickSize)
+	if moveTicks > lot.MaxFavorableTicks {
+		lot.MaxFavorableTicks = moveTicks
 	}
 
 	// Per-trade stop
-	stop := stopFromEntry(position, m.Settings.PerTradeStopTicks, m.Settings.TickSize)
-	if position.StopPrice == 0 {
-		position.StopPrice = stop
+	stop := stopFromEntry(direction, lot, m.StopTicks(), tickSize)
+	if lot.StopPrice == 0 && stop != 0 {
+		lot.StopPrice = stop
+		lot.StopReason = "stop"
 	}
 
 	// Breakeven + 1 tick
-	if m.Settings.BreakevenTicks > 0 && position.MaxFavorableTicks >= m.Settings.BreakevenTicks {
-		beStop := breakevenStop(position, m.Settings.BreakevenPlus, m.Settings.TickSize)
-		position.StopPrice = betterStop(position, position.StopPrice, beStop)
+	if breakeven := m.breakevenTicks(); breakeven > 0 && lot.MaxFavorableTicks >= breakeven {
+		beStop := breakevenStop(direction, lot, m.Settings.BreakevenPlus, tickSize)
+		raiseStop(direction, lot, beStop, "breakeven")
 	}
 
 	// Trailing stop
-	if m.Settings.TrailingTicks > 0 && position.MaxFavorableTicks >= m.Settings.TrailingTicks {
-		trailStop := trailingStop(position, position.MaxFavorableTicks, m.Settings.TrailingTicks, m.Settings.TickSize)
-		position.StopPrice = betterStop(position, position.StopPrice, trailStop)
+	if trailing := m.trailingTicks(); trailing > 0 && lot.MaxFavorableTicks >= trailing {
+		trailStop := trailingStop(direction, lot, lot.MaxFavorableTicks, trailing, tickSize)
+		raiseStop(direction, lot, trailStop, "trail")
 	}
 }
 
-// ApplyDailyPnL enforces the hard daily stop loss.
-func (m *Manager) ApplyDailyPnL(pnl float64) {
-	m.DailyPnL += pnl
-	if m.Settings.DailyStopLoss < 0 && m.DailyPnL <= m.Settings.DailyStopLoss {
-		m.Halted = true
+// PlaceBracket sets a lot's stop and profit-target children from tick
+// distances, falling back to the configured stop (fixed or volatility
+// sized) and TargetTicks when a distance is not positive. MaxTradeLoss tightens the stop further.
+func (m *Manager) PlaceBracket(direction core.Direction, lot *core.Lot, stopTicks, targetTicks int64) {
+	if stopTicks <= 0 {
+		stopTicks = m.StopTicks()
+	}
+	if targetTicks <= 0 {
+		targetTicks = m.Settings.TargetTicks
+	}
+	tickSize := m.tickSize()
+	if stop := stopFromEntry(direction, lot, stopTicks, tickSize); stop != 0 {
+		lot.StopPrice = stop
+		lot.StopReason = "stop"
 	}
+	if cap := m.maxLossStop(direction, lot); cap != 0 {
+		raiseStop(direction, lot, cap, ReasonMaxLoss)
+	}
+	lot.TargetPrice = targetFromEntry(direction, lot, targetTicks, tickSize)
+}
+
+// AllowSize checks a position of size contracts against MaxPositionSize.
+func (m *Manager) AllowSize(size int64) bool {
+	return m.Settings.MaxPositionSize <= 0 || size <= m.Settings.MaxPositionSize
 }
 
-func ticksMoved(position *core.Position, tick core.Tick, tickSize float64) int64 {
+// SizeRoom is how many contracts a position of size can add before
+// MaxPositionSize, or -1 without a limit.
+func (m *Manager) SizeRoom(size int64) int64 {
+	if m.Settings.MaxPositionSize <= 0 {
+		return -1
+	}
+	return max(m.Settings.MaxPositionSize-size, 0)
+}
+
+// StopRisk is the account-currency loss if every lot is stopped out at its
+// current stop price.
+func (m *Manager) StopRisk(position core.Position) float64 {
+	if !position.Open {
+		return 0
+	}
+	var risk float64
+	for _, lot := range position.Lots {
+		if lot.StopPrice == 0 {
+			continue
+		}
+		move := lot.EntryPrice - lot.StopPrice
+		if position.Direction == core.Short {
+			move = -move
+		}
+		risk += m.Contract.Value(move, lot.Size)
+	}
+	return risk
+}
+
+func (m *Manager) tickSize() float64 {
+	if m.Contract.TickSize > 0 {
+		return m.Contract.TickSize
+	}
+	return m.Settings.TickSize
+}
+
+func ticksMoved(direction core.Direction, lot *core.Lot, tick core.Tick, tickSize float64) int64 {
 	if tickSize <= 0 {
 		return 0
 	}
+	// Favorable excursion uses the bar extreme so trailing reflects intrabar highs/lows.
 	var move float64
-	if position.Direction == core.Long {
-		move = tick.Close - position.EntryPrice
+	if direction == core.Long {
+		move = tick.High - lot.EntryPrice
 	} else {
-		move = position.EntryPrice - tick.Close
+		move = lot.EntryPrice - tick.Low
 	}
 	return int64(move / tickSize)
 }
 
-func stopFromEntry(position *core.Position, stopTicks int64, tickSize float64) float64 {
+func stopFromEntry(direction core.Direction, lot *core.Lot, stopTicks int64, tickSize float64) float64 {
 	if stopTicks <= 0 || tickSize <= 0 {
 		return 0
 	}
-	if position.Direction == core.Long {
-		return position.EntryPrice - float64(stopTicks)*tickSize
+	if direction == core.Long {
+		return lot.EntryPrice - float64(stopTicks)*tickSize
+	}
+	return lot.EntryPrice + float64(stopTicks)*tickSize
+}
+
+func targetFromEntry(direction core.Direction, lot *core.Lot, targetTicks int64, tickSize float64) float64 {
+	if targetTicks <= 0 || tickSize <= 0 {
+		return 0
+	}
+	if direction == core.Long {
+		return lot.EntryPrice + float64(targetTicks)*tickSize
 	}
-	return position.EntryPrice + float64(stopTicks)*tickSize
+	return lot.EntryPrice - float64(targetTicks)*tickSize
 }
 
-func breakevenStop(position *core.Position, plusTicks int64, tickSize float64) float64 {
+func breakevenStop(direction core.Direction, lot *core.Lot, plusTicks int64, tickSize float64) float64 {
 	if tickSize <= 0 {
-		return position.EntryPrice
+		return lot.EntryPrice
 	}
 	adj := float64(plusTicks) * tickSize
-	if position.Direction == core.Long {
-		return position.EntryPrice + adj
+	if direction == core.Long {
+		return lot.EntryPrice + adj
 	}
-	return position.EntryPrice - adj
+	return lot.EntryPrice - adj
 }
 
-func trailingStop(position *core.Position, maxTicks int64, trailTicks int64, tickSize float64) float64 {
+func trailingStop(direction core.Direction, lot *core.Lot, maxTicks int64, trailTicks int64, tickSize float64) float64 {
 	if tickSize <= 0 {
-		return position.EntryPrice
+		return lot.EntryPrice
 	}
 	trailFromEntry := float64(maxTicks-trailTicks) * tickSize
-	if position.Direction == core.Long {
-		return position.EntryPrice + trailFromEntry
+	if direction == core.Long {
+		return lot.EntryPrice + trailFromEntry
+	}
+	return lot.EntryPrice - trailFromEntry
+}
+
+// raiseStop moves the stop to candidate when it tightens it, recording the
+// rule responsible.
+func raiseStop(direction core.Direction, lot *core.Lot, candidate float64, reason string) {
+	next := betterStop(direction, lot.StopPrice, candidate)
+	if next != lot.StopPrice {
+		lot.StopPrice = next
+		lot.StopReason = reason
 	}
-	return position.EntryPrice - trailFromEntry
 }
 
-func betterStop(position *core.Position, current, candidate float64) float64 {
+func betterStop(direction core.Direction, current, candidate float64) float64 {
 	if current == 0 {
 		return candidate
 	}
-	if position.Direction == core.Long {
+	if direction == core.Long {
 		if candidate > current {
 			return candidate
 		}
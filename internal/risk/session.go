@@ -0,0 +1,122 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"trading-algo-generator/internal/calendar"
+)
+
+// Exit reasons for the session flatten rules.
+const (
+	ReasonEndOfDay    = "eod"
+	ReasonMaintenance = "maintenance"
+)
+
+// SessionSettings close out positions around the exchange schedule. Times
+// of day are exchange-local; rules tied to the schedule need the manager's
+// Calendar and are skipped without one. Zero values disable each rule.
+// Flattening before economic releases is EventSettings.FlattenBeforeMinutes.
+type SessionSettings struct {
+	// NoEntryMinutes blocks new entries this many minutes before the
+	// regular session closes (the session close when it has no RTH).
+	NoEntryMinutes int
+	// FlattenAt closes every position at this time of day ("15:10") and
+	// blocks entries for the rest of the trade date. On early-close days
+	// it moves to the same distance before the early close.
+	FlattenAt string
+	// FlattenBeforeBreakMinutes closes every position this many minutes
+	// before the daily maintenance break (or an early close).
+	FlattenBeforeBreakMinutes int
+}
+
+// sessionRules is SessionSettings parsed.
+type sessionRules struct {
+	flattenAt calendar.Clock
+}
+
+// Validate parses the settings' times.
+func (s SessionSettings) Validate() error {
+	_, err := s.parse()
+	return err
+}
+
+func (s SessionSettings) parse() (sessionRules, error) {
+	var rules sessionRules
+	if s.FlattenAt != "" {
+		clock, err := calendar.ParseClock(s.FlattenAt)
+		if err != nil {
+			return rules, fmt.Errorf("risk FlattenAt: %w", err)
+		}
+		rules.flattenAt = clock
+	}
+	return rules, nil
+}
+
+// sessionRules parses the settings once; bad settings are caught by
+// Validate before the run and disable the rules here.
+func (m *Manager) sessionRules() sessionRules {
+	if m.rules == nil {
+		rules, _ := m.Settings.Session.parse()
+		m.rules = &rules
+	}
+	return *m.rules
+}
+
+// FlattenDue reports whether a session rule requires the position to be
+// flat at ts, and the exit reason to record.
+func (m *Manager) FlattenDue(ts time.Time) (string, bool) {
+	settings := m.Settings.Session
+	rules := m.sessionRules()
+	if m.Calendar != nil {
+		day := m.Calendar.Day(m.Calendar.TradeDate(ts))
+		if !day.Closed {
+			if deadline, ok := m.flattenTime(day, rules.flattenAt); ok && !ts.Before(deadline) {
+				return ReasonEndOfDay, true
+			}
+			if settings.FlattenBeforeBreakMinutes > 0 && !ts.Before(day.Close.Add(-minutes(settings.FlattenBeforeBreakMinutes))) {
+				return ReasonMaintenance, true
+			}
+		}
+	}
+	if m.eventFlattenDue(ts) {
+		return ReasonEvent, true
+	}
+	return "", false
+}
+
+// flattenTime is the trade date's FlattenAt instant, shifted earlier on
+// early-close days.
+func (m *Manager) flattenTime(day calendar.Day, at calendar.Clock) (time.Time, bool) {
+	if m.Settings.Session.FlattenAt == "" {
+		return time.Time{}, false
+	}
+	deadline := at.On(day.Date)
+	regular, end := m.Calendar.RTHClose.On(day.Date), day.RTHClose
+	if end.IsZero() {
+		regular, end = m.Calendar.Close.On(day.Date), day.Close
+	}
+	if end.Before(regular) {
+		if shifted := end.Add(deadline.Sub(regular)); shifted.Before(deadline) {
+			deadline = shifted
+		}
+	}
+	return deadline, true
+}
+
+// entryWindowOpen applies the no-new-entries window before the close.
+func (m *Manager) entryWindowOpen(ts time.Time) bool {
+	if m.Calendar == nil || m.Settings.Session.NoEntryMinutes <= 0 {
+		return true
+	}
+	day := m.Calendar.Day(m.Calendar.TradeDate(ts))
+	end := day.RTHClose
+	if end.IsZero() {
+		end = day.Close
+	}
+	return ts.Before(end.Add(-minutes(m.Settings.Session.NoEntryMinutes)))
+}
+
+func minutes(n int) time.Duration {
+	return time.Duration(n) * time.Minute
+}
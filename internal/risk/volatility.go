@@ -0,0 +1,181 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"trading-algo-generator/internal/core"
+)
+
+// StopMode selects how stop distances are sized.
+type StopMode int
+
+const (
+	// StopFixed uses the tick counts in Settings.
+	StopFixed StopMode = iota
+	// StopATR uses multiples of the average true range.
+	StopATR
+	// StopRealized uses multiples of the standard deviation of
+	// close-to-close changes.
+	StopRealized
+)
+
+func (m StopMode) String() string {
+	switch m {
+	case StopATR:
+		return "atr"
+	case StopRealized:
+		return "realized"
+	default:
+		return "fixed"
+	}
+}
+
+// ParseStopMode parses a config stop mode; empty means fixed.
+func ParseStopMode(value string) (StopMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "fixed":
+		return StopFixed, nil
+	case "atr":
+		return StopATR, nil
+	case "realized", "volatility":
+		return StopRealized, nil
+	default:
+		return StopFixed, fmt.Errorf("unknown stop mode %q (want fixed, atr or realized)", value)
+	}
+}
+
+// VolatilitySettings size the initial stop, breakeven trigger and trail
+// distance from recent volatility instead of fixed ticks. Each distance is
+// its multiple of the measure over the last Window bars (default 14),
+// rounded to ticks and clamped to MinTicks/MaxTicks when set. A zero
+// multiple, or a measure still warming up, falls back to the fixed tick
+// setting.
+type VolatilitySettings struct {
+	Mode              string
+	Window            int
+	StopMultiple      float64
+	BreakevenMultiple float64
+	TrailingMultiple  float64
+	MinTicks          int64
+	MaxTicks          int64
+}
+
+// Validate checks Mode.
+func (s VolatilitySettings) Validate() error {
+	_, err := ParseStopMode(s.Mode)
+	return err
+}
+
+func (s VolatilitySettings) window() int {
+	if s.Window > 0 {
+		return s.Window
+	}
+	return 14
+}
+
+// VolatilityState is the rolling window behind the measure.
+type VolatilityState struct {
+	Values    []float64
+	PrevClose float64
+}
+
+// Observe feeds a bar into the volatility measure: the realized measure in
+// realized mode, ATR otherwise (position sizing uses it too). Call it once
+// per bar before stops are placed or updated.
+func (m *Manager) Observe(tick core.Tick) {
+	mode, _ := ParseStopMode(m.Settings.Volatility.Mode)
+	state := &m.volatility
+	var value float64
+	switch mode {
+	default:
+		value = tick.High - tick.Low
+		if state.PrevClose != 0 {
+			value = math.Max(value, math.Max(math.Abs(tick.High-state.PrevClose), math.Abs(tick.Low-state.PrevClose)))
+		}
+	case StopRealized:
+		if state.PrevClose == 0 {
+			state.PrevClose = tick.Close
+			return
+		}
+		value = tick.Close - state.PrevClose
+	}
+	state.PrevClose = tick.Close
+	state.Values = append(state.Values, value)
+	if window := m.Settings.Volatility.window(); len(state.Values) > window {
+		state.Values = state.Values[len(state.Values)-window:]
+	}
+}
+
+// Volatility is the current measure in price units, and false until a full
+// window has been observed.
+func (m *Manager) Volatility() (float64, bool) {
+	mode, _ := ParseStopMode(m.Settings.Volatility.Mode)
+	values := m.volatility.Values
+	if len(values) < m.Settings.Volatility.window() {
+		return 0, false
+	}
+	mean := averageOf(values)
+	if mode != StopRealized {
+		return mean, true
+	}
+	var sum float64
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values))), true
+}
+
+// adaptiveTicks converts a multiple of the volatility measure into ticks,
+// or returns fixed when the mode is fixed, the multiple is unset or the
+// measure is not ready.
+func (m *Manager) adaptiveTicks(multiple float64, fixed int64) int64 {
+	if mode, _ := ParseStopMode(m.Settings.Volatility.Mode); mode == StopFixed || multiple <= 0 {
+		return fixed
+	}
+	measure, ok := m.Volatility()
+	tickSize := m.tickSize()
+	if !ok || tickSize <= 0 {
+		return fixed
+	}
+	ticks := int64(math.Ceil(multiple*measure/tickSize - priceEpsilon))
+	settings := m.Settings.Volatility
+	if settings.MinTicks > 0 && ticks < settings.MinTicks {
+		ticks = settings.MinTicks
+	}
+	if settings.MaxTicks > 0 && ticks > settings.MaxTicks {
+		ticks = settings.MaxTicks
+	}
+	if ticks < 1 {
+		ticks = 1
+	}
+	return ticks
+}
+
+// StopTicks is the configured initial stop distance: PerTradeStopTicks, or
+// its volatility-sized replacement.
+func (m *Manager) StopTicks() int64 {
+	return m.adaptiveTicks(m.Settings.Volatility.StopMultiple, m.Settings.PerTradeStopTicks)
+}
+
+func (m *Manager) breakevenTicks() int64 {
+	return m.adaptiveTicks(m.Settings.Volatility.BreakevenMultiple, m.Settings.BreakevenTicks)
+}
+
+func (m *Manager) trailingTicks() int64 {
+	return m.adaptiveTicks(m.Settings.Volatility.TrailingMultiple, m.Settings.TrailingTicks)
+}
+
+const priceEpsilon = 1e-9
+
+func averageOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
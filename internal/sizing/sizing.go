@@ -0,0 +1,212 @@
+// Package sizing turns an entry into a contract count from account equity,
+// the stop distance, volatility and the strategy's track record.
+package sizing
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Policy selects how entries are sized.
+type Policy int
+
+const (
+	// Fixed trades the configured size.
+	Fixed Policy = iota
+	// FixedFractional risks RiskPct of equity over the stop distance.
+	FixedFractional
+	// VolatilityTarget sizes so one bar's typical move is TargetVolatilityPct
+	// of equity.
+	VolatilityTarget
+	// Kelly risks the Kelly fraction of equity implied by the strategy's
+	// win rate and payoff, scaled by KellyFraction and capped at KellyMaxPct.
+	Kelly
+)
+
+func (p Policy) String() string {
+	switch p {
+	case FixedFractional:
+		return "fixed_fractional"
+	case VolatilityTarget:
+		return "volatility"
+	case Kelly:
+		return "kelly"
+	default:
+		return "fixed"
+	}
+}
+
+// ParsePolicy parses a config sizing policy; empty means fixed.
+func ParsePolicy(value string) (Policy, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "fixed":
+		return Fixed, nil
+	case "fixed_fractional", "fractional":
+		return FixedFractional, nil
+	case "volatility", "volatility_target":
+		return VolatilityTarget, nil
+	case "kelly":
+		return Kelly, nil
+	default:
+		return Fixed, fmt.Errorf("unknown sizing policy %q (want fixed, fixed_fractional, volatility or kelly)", value)
+	}
+}
+
+// Settings configure a Sizer. Percentages are of current equity, which
+// starts at StartingEquity and moves with every closed trade's net PnL.
+type Settings struct {
+	Policy              string
+	StartingEquity      float64
+	RiskPct             float64
+	TargetVolatilityPct float64
+	// KellyFraction scales full Kelly (0.5 is half Kelly; default 1).
+	// Until KellyMinTrades trades (default 20) have closed, Kelly trades
+	// the configured size.
+	KellyFraction  float64
+	KellyMaxPct    float64
+	KellyMinTrades int
+	// ScaleByConfidence multiplies the policy's size by the signal's
+	// Confidence (clamped to 0-1).
+	ScaleByConfidence bool
+	// MinContracts and MaxContracts are hard limits. A size that rounds to
+	// zero skips the entry unless MinContracts is set.
+	MinContracts int64
+	MaxContracts int64
+}
+
+// Inputs describe one entry. Money is in account currency.
+type Inputs struct {
+	// Base is the configured contract count.
+	Base int64
+	// StopRisk is the loss per contract if the initial stop is hit.
+	StopRisk float64
+	// Volatility is one bar's typical move per contract; zero when the
+	// measure is not ready.
+	Volatility float64
+	Confidence float64
+	// WinRate, Payoff (average win over average loss) and Trades describe
+	// the strategy's closed trades so far.
+	WinRate float64
+	Payoff  float64
+	Trades  int
+}
+
+// Sizer applies a sizing policy against a running equity figure.
+type Sizer struct {
+	Settings Settings
+	Equity   EquityTracker
+	policy   Policy
+}
+
+// New validates settings and starts the equity tracker.
+func New(settings Settings) (*Sizer, error) {
+	policy, err := ParsePolicy(settings.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if policy != Fixed && settings.StartingEquity <= 0 {
+		return nil, fmt.Errorf("sizing policy %s needs a positive StartingEquity", policy)
+	}
+	if settings.MaxContracts > 0 && settings.MinContracts > settings.MaxContracts {
+		return nil, fmt.Errorf("sizing MinContracts %d exceeds MaxContracts %d", settings.MinContracts, settings.MaxContracts)
+	}
+	return &Sizer{Settings: settings, Equity: EquityTracker{Start: settings.StartingEquity}, policy: policy}, nil
+}
+
+// Policy is the parsed sizing policy.
+func (s *Sizer) Policy() Policy {
+	return s.policy
+}
+
+// Size is the contract count for an entry; zero skips it.
+func (s *Sizer) Size(in Inputs) int64 {
+	equity := s.Equity.Equity()
+	size := float64(in.Base)
+	switch s.policy {
+	case FixedFractional:
+		size = perRisk(equity*s.Settings.RiskPct/100, in.StopRisk)
+	case VolatilityTarget:
+		if in.Volatility > 0 {
+			size = perRisk(equity*s.Settings.TargetVolatilityPct/100, in.Volatility)
+		}
+	case Kelly:
+		if in.Trades >= s.kellyMinTrades() {
+			size = perRisk(equity*s.kellyPct(in)/100, in.StopRisk)
+		}
+	}
+	if s.Settings.ScaleByConfidence {
+		size *= math.Max(0, math.Min(1, in.Confidence))
+	}
+	contracts := int64(math.Floor(size + 1e-9))
+	if s.policy == Fixed && !s.Settings.ScaleByConfidence {
+		contracts = in.Base
+	}
+	if contracts < s.Settings.MinContracts {
+		contracts = s.Settings.MinContracts
+	}
+	if s.Settings.MaxContracts > 0 && contracts > s.Settings.MaxContracts {
+		contracts = s.Settings.MaxContracts
+	}
+	if contracts < 0 {
+		return 0
+	}
+	return contracts
+}
+
+// kellyPct is the capped, scaled Kelly percentage of equity to risk:
+// W - (1-W)/R for win rate W and payoff R.
+func (s *Sizer) kellyPct(in Inputs) float64 {
+	if in.Payoff <= 0 {
+		return 0
+	}
+	fraction := s.Settings.KellyFraction
+	if fraction <= 0 {
+		fraction = 1
+	}
+	pct := (in.WinRate - (1-in.WinRate)/in.Payoff) * fraction * 100
+	if s.Settings.KellyMaxPct > 0 && pct > s.Settings.KellyMaxPct {
+		pct = s.Settings.KellyMaxPct
+	}
+	return math.Max(0, pct)
+}
+
+func (s *Sizer) kellyMinTrades() int {
+	if s.Settings.KellyMinTrades > 0 {
+		return s.Settings.KellyMinTrades
+	}
+	return 20
+}
+
+func perRisk(budget, risk float64) float64 {
+	if risk <= 0 {
+		return 0
+	}
+	return budget / risk
+}
+
+// EquityTracker follows account equity through closed trades.
+type EquityTracker struct {
+	Start    float64
+	Realized float64
+	Peak     float64
+}
+
+// Record books a closed trade's net PnL.
+func (t *EquityTracker) Record(pnl float64) {
+	t.Realized += pnl
+	if equity := t.Equity(); equity > t.Peak {
+		t.Peak = equity
+	}
+}
+
+// Equity is the starting equity plus realized PnL.
+func (t *EquityTracker) Equity() float64 {
+	return t.Start + t.Realized
+}
+
+// Drawdown is how far equity is below its peak.
+func (t *EquityTracker) Drawdown() float64 {
+	peak := math.Max(t.Peak, t.Start)
+	return math.Max(0, peak-t.Equity())
+}
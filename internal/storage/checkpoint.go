@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"trading-algo-generator/internal/core"
+)
+
+// Checkpoint is a live run's saved state: the engine's, plus the
+// in-process broker's when it keeps any.
+type Checkpoint struct {
+	SavedAt time.Time
+	Symbol  string
+	Engine  core.EngineState
+	Broker  json.RawMessage `json:",omitempty"`
+}
+
+// CheckpointStore keeps the latest checkpoint in one JSON file, replaced
+// atomically on every save so a crash mid-write leaves the previous one.
+type CheckpointStore struct {
+	Path string
+}
+
+func (s CheckpointStore) Save(checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	return WriteFileAtomic(s.Path, data)
+}
+
+func (s CheckpointStore) Load() (Checkpoint, error) {
+	var checkpoint Checkpoint
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return checkpoint, err
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("decode checkpoint %s: %w", s.Path, err)
+	}
+	return checkpoint, nil
+}
@@ -1,6 +1,7 @@
 package strategy
 
 import (
+	"encoding/json"
 	"math"
 
 	"trading-algo-generator/internal/core"
@@ -8,9 +9,15 @@ import (
 
 // BreakoutConfig controls the breakout template.
 type BreakoutConfig struct {
-	Lookback int
-	MinRange float64
-	Confidence float64
+	Lookback   int     `doc:"bars in the range window"`
+	MinRange   float64 `doc:"smallest range, in points, worth trading"`
+	Confidence float64 `doc:"base signal confidence, raised with range size"`
+}
+
+func init() {
+	Register("breakout", "Trades closes beyond the high or low of the recent range.",
+		BreakoutConfig{Lookback: 20, Confidence: 0.55},
+		func(params BreakoutConfig) (Strategy, error) { return &BreakoutStrategy{Config: params}, nil })
 }
 
 // BreakoutStrategy trades when price breaks out of recent range.
@@ -60,9 +67,35 @@ func (s *BreakoutStrategy) OnTick(tick core.Tick, features core.FeatureSet, posi
 	return nil
 }
 
+// EntryValid holds while price stays beyond the middle of the lookback
+// range on the breakout's side.
+func (s *BreakoutStrategy) EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool {
+	if len(s.window) == 0 {
+		return true
+	}
+	high, low := s.window[0].High, s.window[0].Low
+	for _, t := range s.window {
+		high = math.Max(high, t.High)
+		low = math.Min(low, t.Low)
+	}
+	mid := (high + low) / 2
+	if direction == core.Long {
+		return tick.Close > mid
+	}
+	return tick.Close < mid
+}
+
 func confidence(base, rangeSize float64) float64 {
 	if base <= 0 {
 		base = 0.55
 	}
 	return math.Min(0.99, base+rangeSize*0.01)
 }
+
+func (s *BreakoutStrategy) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(s.window)
+}
+
+func (s *BreakoutStrategy) Restore(data json.RawMessage) error {
+	return json.Unmarshal(data, &s.window)
+}
@@ -6,9 +6,15 @@ import (
 
 // DeltaTrendConfig aligns order flow with profile skew.
 type DeltaTrendConfig struct {
-	DeltaThreshold float64
-	ProfileSkew    float64
-	MinVolume      float64
+	DeltaThreshold float64 `doc:"normalized bid/ask delta needed to enter"`
+	ProfileSkew    float64 `doc:"volume profile skew needed in the same direction"`
+	MinVolume      float64 `doc:"smallest average bar volume to trade"`
+}
+
+func init() {
+	Register("delta_trend", "Follows order flow when delta and the volume profile skew agree.",
+		DeltaTrendConfig{DeltaThreshold: 0.35, ProfileSkew: 0.1},
+		func(params DeltaTrendConfig) (Strategy, error) { return &DeltaTrendStrategy{Config: params}, nil })
 }
 
 // DeltaTrendStrategy takes trend trades when order flow aligns with profile.
@@ -36,3 +42,12 @@ func (s *DeltaTrendStrategy) OnTick(tick core.Tick, features core.FeatureSet, po
 	}
 	return nil
 }
+
+// EntryValid holds while order flow has not turned against the position.
+func (s *DeltaTrendStrategy) EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool {
+	delta := features.Values["delta_norm"]
+	if direction == core.Long {
+		return delta >= 0
+	}
+	return delta <= 0
+}
@@ -0,0 +1,47 @@
+package ensemble
+
+import "trading-algo-generator/internal/core"
+
+// MemberStats is how the trades a member voted for went.
+type MemberStats struct {
+	Member string
+	Trades int
+	Wins   int
+	PnL    float64
+}
+
+// Attribute credits each trade to the members whose votes were behind the
+// decision that opened its lot. Stats are in member order; unattributed
+// counts trades with no recorded decision, such as lots adopted from the
+// broker or entries older than a resumed checkpoint kept.
+func (s *Strategy) Attribute(trades []core.Trade) (stats []MemberStats, unattributed int) {
+	stats = make([]MemberStats, len(s.members))
+	index := make(map[string]int, len(s.members))
+	for i, m := range s.members {
+		stats[i].Member = m.label
+		index[m.label] = i
+	}
+	decisions := make(map[string]Decision, len(s.Decisions))
+	for _, decision := range s.Decisions {
+		decisions[decision.OrderID] = decision
+	}
+	for _, trade := range trades {
+		decision, ok := decisions[trade.LotID]
+		if !ok {
+			unattributed++
+			continue
+		}
+		for _, vote := range decision.Votes {
+			if vote.Direction != trade.Direction {
+				continue
+			}
+			member := &stats[index[vote.Member]]
+			member.Trades++
+			member.PnL += trade.PnL
+			if trade.PnL > 0 {
+				member.Wins++
+			}
+		}
+	}
+	return stats, unattributed
+}
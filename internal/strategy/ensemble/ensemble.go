@@ -0,0 +1,406 @@
+// Package ensemble combines several registered strategies into one that
+// enters on their votes, and records each decision's member signals so
+// trades can be attributed to the members that called them.
+package ensemble
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/strategy"
+)
+
+// Mode decides how member votes become an entry.
+type Mode int
+
+const (
+	// Majority enters when more than half of the members vote the same way.
+	Majority Mode = iota
+	// Weighted enters when the weighted sum of signed confidences, over the
+	// total weight, reaches Threshold.
+	Weighted
+	// Unanimous enters only when every member votes the same way.
+	Unanimous
+	// Filter enters on the first member's signals, and only when every other
+	// member has a vote in the same direction.
+	Filter
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Weighted:
+		return "weighted"
+	case Unanimous:
+		return "unanimous"
+	case Filter:
+		return "filter"
+	default:
+		return "majority"
+	}
+}
+
+// ParseMode parses a config mode; empty means majority.
+func ParseMode(value string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "majority", "vote":
+		return Majority, nil
+	case "weighted", "weight":
+		return Weighted, nil
+	case "unanimous", "all":
+		return Unanimous, nil
+	case "filter":
+		return Filter, nil
+	default:
+		return Majority, fmt.Errorf("unknown ensemble mode %q (want majority, weighted, unanimous or filter)", value)
+	}
+}
+
+// DefaultThreshold is Weighted mode's entry threshold when none is set.
+const DefaultThreshold = 0.3
+
+// MaxSavedDecisions is how many of the latest decisions a checkpoint
+// keeps; the live history is never trimmed.
+const MaxSavedDecisions = 1000
+
+// Config is an ensemble of registered strategies.
+type Config struct {
+	Mode    string   `doc:"majority, weighted, unanimous or filter"`
+	Members []Member `doc:"strategies to combine; under filter the first is the signal and the rest filters"`
+	// Window is how many bars a member's entry signal counts as its vote.
+	Window    int     `doc:"bars a member's entry signal stays a vote (default 1, that bar only)"`
+	Threshold float64 `doc:"weighted mode: share of total weight needed to enter (default 0.3)"`
+}
+
+// Member is one strategy in the ensemble. Label defaults to the strategy
+// name and must be unique; Weight defaults to 1.
+type Member struct {
+	Label    string
+	Strategy string
+	Params   json.RawMessage
+	Weight   float64
+}
+
+func init() {
+	strategy.Register("ensemble", "Combines other strategies by majority, weighted or unanimous vote, or as filters.",
+		Config{},
+		func(params Config) (strategy.Strategy, error) { return New(params) })
+}
+
+// Strategy runs its members on every bar and turns their votes into
+// signals.
+type Strategy struct {
+	Config Config
+	Mode   Mode
+	// Decisions records the entries that filled with the member votes
+	// behind them, oldest first.
+	Decisions []Decision
+
+	members []member
+	bars    int
+	// pending is the last entry signalled, recorded once its order fills.
+	pending *Decision
+}
+
+type member struct {
+	label    string
+	weight   float64
+	strategy strategy.Strategy
+	vote     *Vote
+	voteBar  int
+}
+
+// Vote is a member's latest entry signal.
+type Vote struct {
+	Member     string
+	Direction  core.Direction
+	Confidence float64
+	Reason     string
+	Time       time.Time
+}
+
+// Decision is an entry signal and the votes it was made from. OrderID is
+// the entry order that filled it, which is the ID of the lot it opened.
+type Decision struct {
+	OrderID    string
+	Time       time.Time
+	Direction  core.Direction
+	Confidence float64
+	Reason     string
+	Votes      []Vote
+}
+
+// New builds every member from the registry.
+func New(cfg Config) (*Strategy, error) {
+	mode, err := ParseMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Members) < 2 {
+		return nil, fmt.Errorf("ensemble needs at least two members, got %d", len(cfg.Members))
+	}
+	if cfg.Window < 0 || cfg.Threshold < 0 || cfg.Threshold > 1 {
+		return nil, fmt.Errorf("ensemble Window must be non-negative and Threshold within 0..1")
+	}
+	if cfg.Window == 0 {
+		cfg.Window = 1
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultThreshold
+	}
+	s := &Strategy{Config: cfg, Mode: mode}
+	seen := map[string]bool{}
+	for i, m := range cfg.Members {
+		label := m.Label
+		if label == "" {
+			label = m.Strategy
+		}
+		if seen[label] {
+			return nil, fmt.Errorf("ensemble member %d: label %q used twice", i+1, label)
+		}
+		seen[label] = true
+		if m.Weight < 0 {
+			return nil, fmt.Errorf("ensemble member %s: negative weight %g", label, m.Weight)
+		}
+		weight := m.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		built, err := strategy.Build(m.Strategy, m.Params)
+		if err != nil {
+			return nil, fmt.Errorf("ensemble member %s: %w", label, err)
+		}
+		s.members = append(s.members, member{label: label, weight: weight, strategy: built})
+	}
+	return s, nil
+}
+
+func (s *Strategy) Name() string { return "ensemble" }
+
+// OnTick runs every member, then signals an entry when the mode's vote
+// passes and at least one vote is from this bar. An exit signal from any
+// member closes the position; members' other intents, order types and
+// brackets are not passed on.
+func (s *Strategy) OnTick(tick core.Tick, features core.FeatureSet, position core.Position) *core.Signal {
+	s.bars++
+	var exit *core.Signal
+	fresh := make([]bool, len(s.members))
+	for i := range s.members {
+		m := &s.members[i]
+		signal := m.strategy.OnTick(tick, features, position)
+		if signal == nil {
+			continue
+		}
+		switch {
+		case signal.Intent == core.Exit:
+			if exit == nil && position.Open {
+				exit = &core.Signal{Timestamp: tick.Timestamp, Direction: position.Direction, Intent: core.Exit, Reason: m.label + ":" + signal.Reason}
+			}
+		case signal.Intent == core.Enter && signal.Direction != core.Flat:
+			m.vote = &Vote{Member: m.label, Direction: signal.Direction, Confidence: signal.Confidence, Reason: signal.Reason, Time: tick.Timestamp}
+			m.voteBar = s.bars
+			fresh[i] = true
+		}
+	}
+	if exit != nil {
+		return exit
+	}
+	if position.Open {
+		return nil
+	}
+	votes := s.votes()
+	direction, confidence := s.decide(votes, fresh)
+	if direction == core.Flat {
+		return nil
+	}
+	var cast []Vote
+	var labels []string
+	for _, vote := range votes {
+		if vote != nil {
+			cast = append(cast, *vote)
+			if vote.Direction == direction {
+				labels = append(labels, vote.Member)
+			}
+		}
+	}
+	reason := s.Mode.String() + ":" + strings.Join(labels, "+")
+	s.pending = &Decision{Time: tick.Timestamp, Direction: direction, Confidence: confidence, Reason: reason, Votes: cast}
+	return &core.Signal{Timestamp: tick.Timestamp, Direction: direction, Confidence: confidence, Reason: reason}
+}
+
+// votes are the members' votes still inside the window, nil for members
+// without one, in member order.
+func (s *Strategy) votes() []*Vote {
+	votes := make([]*Vote, len(s.members))
+	for i, m := range s.members {
+		if m.vote != nil && s.bars-m.voteBar < s.Config.Window {
+			votes[i] = m.vote
+		}
+	}
+	return votes
+}
+
+// decide applies the mode to the votes; Flat means no entry.
+func (s *Strategy) decide(votes []*Vote, fresh []bool) (core.Direction, float64) {
+	anyFresh := false
+	for _, f := range fresh {
+		anyFresh = anyFresh || f
+	}
+	if !anyFresh {
+		return core.Flat, 0
+	}
+	n := len(s.members)
+	switch s.Mode {
+	case Weighted:
+		var score, total float64
+		for i, vote := range votes {
+			total += s.members[i].weight
+			if vote != nil {
+				score += s.members[i].weight * vote.Confidence * sign(vote.Direction)
+			}
+		}
+		score /= total
+		if math.Abs(score) < s.Config.Threshold || score == 0 {
+			return core.Flat, 0
+		}
+		if score > 0 {
+			return core.Long, math.Min(1, score)
+		}
+		return core.Short, math.Min(1, -score)
+	case Filter:
+		primary := votes[0]
+		if primary == nil || !fresh[0] {
+			return core.Flat, 0
+		}
+		for _, vote := range votes[1:] {
+			if vote == nil || vote.Direction != primary.Direction {
+				return core.Flat, 0
+			}
+		}
+		return primary.Direction, primary.Confidence
+	}
+	for _, direction := range []core.Direction{core.Long, core.Short} {
+		var count int
+		var confidence float64
+		for _, vote := range votes {
+			if vote != nil && vote.Direction == direction {
+				count++
+				confidence += vote.Confidence
+			}
+		}
+		if (s.Mode == Unanimous && count == n) || (s.Mode == Majority && count*2 > n) {
+			return direction, confidence / float64(count)
+		}
+	}
+	return core.Flat, 0
+}
+
+func sign(direction core.Direction) float64 {
+	if direction == core.Short {
+		return -1
+	}
+	return 1
+}
+
+// OnOrderEvent passes order events to members that want them, and records
+// the pending decision once its entry fills. An entry that is rejected or
+// cancelled unfilled drops it, so members are never credited with trades
+// that did not happen.
+func (s *Strategy) OnOrderEvent(event core.OrderEvent) {
+	for _, m := range s.members {
+		if handler, ok := m.strategy.(strategy.OrderEventHandler); ok {
+			handler.OnOrderEvent(event)
+		}
+	}
+	if s.pending == nil || event.Order.Direction != s.pending.Direction {
+		return
+	}
+	switch {
+	case event.Fill.Size > 0:
+		decision := *s.pending
+		decision.OrderID = event.Order.ID
+		s.Decisions = append(s.Decisions, decision)
+		s.pending = nil
+	case event.Type == core.OrderRejected || event.Type == core.OrderCancelled || event.Type == core.OrderExpired:
+		s.pending = nil
+	}
+}
+
+// EntryValid holds while any member that can judge its entry condition
+// still finds it valid, and always when no member can.
+func (s *Strategy) EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool {
+	checked := false
+	for _, m := range s.members {
+		if checker, ok := m.strategy.(strategy.EntryConditionChecker); ok {
+			if checker.EntryValid(tick, features, direction) {
+				return true
+			}
+			checked = true
+		}
+	}
+	return !checked
+}
+
+// snapshot is the ensemble's checkpointed state.
+type snapshot struct {
+	Bars      int
+	Votes     map[string]savedVote
+	Members   map[string]json.RawMessage
+	Decisions []Decision `json:",omitempty"`
+	Pending   *Decision  `json:",omitempty"`
+}
+
+type savedVote struct {
+	Vote Vote
+	Bar  int
+}
+
+func (s *Strategy) Snapshot() (json.RawMessage, error) {
+	state := snapshot{Bars: s.bars, Votes: map[string]savedVote{}, Members: map[string]json.RawMessage{}, Decisions: s.Decisions, Pending: s.pending}
+	if n := len(state.Decisions); n > MaxSavedDecisions {
+		state.Decisions = state.Decisions[n-MaxSavedDecisions:]
+	}
+	for _, m := range s.members {
+		if m.vote != nil {
+			state.Votes[m.label] = savedVote{Vote: *m.vote, Bar: m.voteBar}
+		}
+		if snapshotter, ok := m.strategy.(core.Snapshotter); ok {
+			data, err := snapshotter.Snapshot()
+			if err != nil {
+				return nil, fmt.Errorf("ensemble member %s: %w", m.label, err)
+			}
+			state.Members[m.label] = data
+		}
+	}
+	return json.Marshal(state)
+}
+
+func (s *Strategy) Restore(data json.RawMessage) error {
+	var state snapshot
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.bars = state.Bars
+	s.Decisions = state.Decisions
+	s.pending = state.Pending
+	for i := range s.members {
+		m := &s.members[i]
+		if saved, ok := state.Votes[m.label]; ok {
+			vote := saved.Vote
+			m.vote, m.voteBar = &vote, saved.Bar
+		}
+		if raw, ok := state.Members[m.label]; ok {
+			snapshotter, ok := m.strategy.(core.Snapshotter)
+			if !ok {
+				return fmt.Errorf("ensemble member %s has saved state but cannot restore it", m.label)
+			}
+			if err := snapshotter.Restore(raw); err != nil {
+				return fmt.Errorf("ensemble member %s: %w", m.label, err)
+			}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package strategy
 
 import (
+	"encoding/json"
 	"math"
 
 	"trading-algo-generator/internal/core"
@@ -8,8 +9,14 @@ import (
 
 // MeanReversionConfig controls mean reversion logic.
 type MeanReversionConfig struct {
-	ZThreshold float64
-	Lookback   int
+	ZThreshold float64 `doc:"z-score of the close beyond which to fade"`
+	Lookback   int     `doc:"bars in the mean and deviation window"`
+}
+
+func init() {
+	Register("mean_reversion", "Fades closes stretched beyond a z-score from the rolling mean.",
+		MeanReversionConfig{ZThreshold: 2, Lookback: 30},
+		func(params MeanReversionConfig) (Strategy, error) { return &MeanReversionStrategy{Config: params}, nil })
 }
 
 // MeanReversionStrategy fades extended moves.
@@ -49,6 +56,19 @@ func (s *MeanReversionStrategy) OnTick(tick core.Tick, features core.FeatureSet,
 	return nil
 }
 
+// EntryValid holds while price is still on the stretched side of the mean
+// the fade was entered from.
+func (s *MeanReversionStrategy) EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool {
+	if len(s.window) == 0 {
+		return true
+	}
+	mean, _ := meanStd(s.window)
+	if direction == core.Long {
+		return tick.Close < mean
+	}
+	return tick.Close > mean
+}
+
 func meanStd(values []float64) (float64, float64) {
 	if len(values) == 0 {
 		return 0, 0
@@ -66,3 +86,11 @@ func meanStd(values []float64) (float64, float64) {
 	variance /= float64(len(values))
 	return mean, math.Sqrt(variance)
 }
+
+func (s *MeanReversionStrategy) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(s.window)
+}
+
+func (s *MeanReversionStrategy) Restore(data json.RawMessage) error {
+	return json.Unmarshal(data, &s.window)
+}
@@ -0,0 +1,174 @@
+package strategy
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"trading-algo-generator/internal/core"
+)
+
+// ORBConfig controls the opening-range breakout template. Prices are in
+// points.
+type ORBConfig struct {
+	RangeMinutes int     `doc:"minutes after the RTH open that form the opening range"`
+	MinRange     float64 `doc:"smallest opening range worth trading (0: no minimum)"`
+	MaxRange     float64 `doc:"largest opening range worth trading (0: no maximum)"`
+	// Retest waits, after a close beyond the range, for a bar that comes
+	// back to within RetestTolerance of the broken level and closes beyond
+	// it again.
+	Retest          bool    `doc:"enter on a retest of the broken level instead of the break"`
+	RetestTolerance float64 `doc:"how close to the broken level a retest must come"`
+	EntryMinutes    int     `doc:"minutes after the RTH open to stop taking entries (0: all session)"`
+	Confidence      float64 `doc:"signal confidence"`
+}
+
+func init() {
+	Register("orb", "Trades breaks of the RTH opening range, once per direction per day.",
+		ORBConfig{RangeMinutes: 15, Confidence: 0.6},
+		func(params ORBConfig) (Strategy, error) { return &ORBStrategy{Config: params}, nil })
+}
+
+// orbSessionGap is the pause in RTH ticks taken as a new session when the
+// session label alone does not change, as with RTH-only data.
+const orbSessionGap = time.Hour
+
+// ORBStrategy builds the high and low of the first RangeMinutes of each
+// regular session from Tick.Session and trades closes beyond them.
+type ORBStrategy struct {
+	Config ORBConfig
+	State  ORBState
+}
+
+// ORBState is one session's opening range and what has been traded off it.
+type ORBState struct {
+	Open     time.Time
+	LastTick time.Time
+	High     float64
+	Low      float64
+	// Ready is set once the range is complete; Skip when it failed the
+	// range filter.
+	Ready bool
+	Skip  bool
+	// Armed is the direction of a break waiting for its retest, Pending
+	// that of the entry signalled and not yet filled.
+	Armed       core.Direction
+	Pending     core.Direction
+	TradedLong  bool
+	TradedShort bool
+}
+
+func (s *ORBStrategy) Name() string { return "orb" }
+
+func (s *ORBStrategy) OnTick(tick core.Tick, features core.FeatureSet, position core.Position) *core.Signal {
+	if !strings.EqualFold(tick.Session, "RTH") {
+		s.State = ORBState{LastTick: tick.Timestamp}
+		return nil
+	}
+	state := &s.State
+	if state.Open.IsZero() || tick.Timestamp.Sub(state.LastTick) > orbSessionGap {
+		*state = ORBState{Open: tick.Timestamp, High: tick.High, Low: tick.Low}
+	}
+	state.LastTick = tick.Timestamp
+
+	rangeEnd := state.Open.Add(time.Duration(s.rangeMinutes()) * time.Minute)
+	if tick.Timestamp.Before(rangeEnd) {
+		if tick.High > state.High {
+			state.High = tick.High
+		}
+		if tick.Low < state.Low {
+			state.Low = tick.Low
+		}
+		return nil
+	}
+	if !state.Ready {
+		state.Ready = true
+		size := state.High - state.Low
+		state.Skip = size < s.Config.MinRange || (s.Config.MaxRange > 0 && size > s.Config.MaxRange)
+	}
+	if state.Skip || position.Open {
+		return nil
+	}
+	if s.Config.EntryMinutes > 0 && !tick.Timestamp.Before(state.Open.Add(time.Duration(s.Config.EntryMinutes)*time.Minute)) {
+		return nil
+	}
+
+	direction, reason := core.Flat, ""
+	switch {
+	case tick.Close > state.High && !state.TradedLong:
+		direction, reason = core.Long, "orb_break_high"
+	case tick.Close < state.Low && !state.TradedShort:
+		direction, reason = core.Short, "orb_break_low"
+	}
+	if s.Config.Retest {
+		// A break arms its direction and a close back inside the range
+		// disarms it; entries wait for a later bar that retests the level.
+		if direction == core.Flat || direction != state.Armed || !s.retested(tick, direction) {
+			state.Armed = direction
+			return nil
+		}
+		reason += "_retest"
+	}
+	if direction == core.Flat {
+		return nil
+	}
+	state.Pending = direction
+	return &core.Signal{Timestamp: tick.Timestamp, Direction: direction, Confidence: s.confidence(), Reason: reason}
+}
+
+// OnOrderEvent uses up the day's trade in a direction once its entry
+// fills, so entries the risk checks block can still be taken later.
+func (s *ORBStrategy) OnOrderEvent(event core.OrderEvent) {
+	if event.Fill.Size == 0 || s.State.Pending == core.Flat || event.Order.Direction != s.State.Pending {
+		return
+	}
+	if s.State.Pending == core.Long {
+		s.State.TradedLong = true
+	} else {
+		s.State.TradedShort = true
+	}
+	s.State.Pending = core.Flat
+}
+
+// retested reports whether the bar came back to the broken level.
+func (s *ORBStrategy) retested(tick core.Tick, direction core.Direction) bool {
+	if direction == core.Long {
+		return tick.Low <= s.State.High+s.Config.RetestTolerance
+	}
+	return tick.High >= s.State.Low-s.Config.RetestTolerance
+}
+
+func (s *ORBStrategy) rangeMinutes() int {
+	if s.Config.RangeMinutes <= 0 {
+		return 15
+	}
+	return s.Config.RangeMinutes
+}
+
+func (s *ORBStrategy) confidence() float64 {
+	if s.Config.Confidence <= 0 {
+		return 0.6
+	}
+	return s.Config.Confidence
+}
+
+// EntryValid holds while price stays beyond the middle of the opening range
+// on the breakout's side.
+func (s *ORBStrategy) EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool {
+	if !s.State.Ready {
+		return true
+	}
+	mid := (s.State.High + s.State.Low) / 2
+	if direction == core.Long {
+		return tick.Close > mid
+	}
+	return tick.Close < mid
+}
+
+func (s *ORBStrategy) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(s.State)
+}
+
+func (s *ORBStrategy) Restore(data json.RawMessage) error {
+	return json.Unmarshal(data, &s.State)
+}
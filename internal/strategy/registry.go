@@ -0,0 +1,169 @@
+package strategy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Definition is a registered strategy: a factory over its parameter struct
+// and the defaults config params are decoded on top of.
+type Definition struct {
+	Name        string
+	Description string
+	// Defaults is the parameter struct with its default values; its type
+	// is the strategy's parameter schema.
+	Defaults any
+	build    func(params json.RawMessage) (Strategy, error)
+}
+
+// Param describes one field of a strategy's parameter struct.
+type Param struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     any    `json:"default"`
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Definition{}
+)
+
+// Register adds a strategy under name, usually from an init function in
+// the package that implements it. Config params are decoded onto a deep
+// copy of defaults, unknown fields rejected, and passed to build. Field tags
+// `doc:"..."` describe parameters in the schema. Registering a name twice
+// panics.
+func Register[P any](name, description string, defaults P, build func(P) (Strategy, error)) {
+	if reflect.TypeOf(defaults).Kind() != reflect.Struct {
+		panic(fmt.Sprintf("strategy %s: parameters must be a struct", name))
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("strategy %s registered twice", name))
+	}
+	// Each build decodes a fresh copy of the defaults, so params decoded on
+	// top never write into slices or maps shared with other builds.
+	encoded, err := json.Marshal(defaults)
+	if err != nil {
+		panic(fmt.Sprintf("strategy %s: encode defaults: %v", name, err))
+	}
+	registry[name] = Definition{
+		Name:        name,
+		Description: description,
+		Defaults:    defaults,
+		build: func(raw json.RawMessage) (Strategy, error) {
+			var params P
+			if err := json.Unmarshal(encoded, &params); err != nil {
+				return nil, fmt.Errorf("strategy %s defaults: %w", name, err)
+			}
+			if len(bytes.TrimSpace(raw)) > 0 && !bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+				decoder := json.NewDecoder(bytes.NewReader(raw))
+				decoder.DisallowUnknownFields()
+				if err := decoder.Decode(&params); err != nil {
+					return nil, fmt.Errorf("strategy %s params: %w", name, err)
+				}
+			}
+			return build(params)
+		},
+	}
+}
+
+// ErrUnknown is wrapped by Build for names nothing registered.
+var ErrUnknown = errors.New("unknown strategy")
+
+// Build creates the strategy registered under name from its config params.
+func Build(name string, params json.RawMessage) (Strategy, error) {
+	definition, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %q (registered: %s)", ErrUnknown, name, strings.Join(Names(), ", "))
+	}
+	return definition.build(params)
+}
+
+// Lookup returns the definition registered under name.
+func Lookup(name string) (Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	definition, ok := registry[name]
+	return definition, ok
+}
+
+// Names lists the registered strategies in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Registered returns every definition, sorted by name.
+func Registered() []Definition {
+	names := Names()
+	definitions := make([]Definition, 0, len(names))
+	for _, name := range names {
+		definition, _ := Lookup(name)
+		definitions = append(definitions, definition)
+	}
+	return definitions
+}
+
+// Schema lists the parameters in field order with their defaults.
+func (d Definition) Schema() []Param {
+	value := reflect.ValueOf(d.Defaults)
+	kind := value.Type()
+	params := make([]Param, 0, kind.NumField())
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		params = append(params, Param{
+			Name:        name,
+			Type:        typeName(field.Type),
+			Default:     value.Field(i).Interface(),
+			Description: field.Tag.Get("doc"),
+		})
+	}
+	return params
+}
+
+// typeName is a JSON-flavoured name for a parameter's Go type.
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "[]" + typeName(t.Elem())
+	case reflect.Map:
+		return "map[string]" + typeName(t.Elem())
+	case reflect.Pointer:
+		return typeName(t.Elem())
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,439 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled condition over feature values. Numbers, feature names
+// (with an optional lookback, ohlcv_close[3] being three bars ago),
+// arithmetic, comparisons, crosses_above/crosses_below, &&/and, ||/or,
+// !/not, parentheses and abs/min/max are supported. Booleans are 1 and 0;
+// anything involving a missing value is false.
+type Expr struct {
+	src  string
+	root node
+	// lags is how many past bars of each name the expression reads.
+	lags map[string]int
+}
+
+// Compile parses an expression.
+func Compile(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", src, err)
+	}
+	p := &parser{tokens: tokens, lags: map[string]int{}}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", src, err)
+	}
+	return &Expr{src: src, root: root, lags: p.lags}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// True evaluates the expression against the history's latest bar.
+func (e *Expr) True(h *History) bool {
+	return truthy(e.root.eval(h, 0))
+}
+
+// Value evaluates the expression as a number.
+func (e *Expr) Value(h *History) float64 {
+	return e.root.eval(h, 0)
+}
+
+// node is a compiled expression term, evaluated lag bars back.
+type node interface {
+	eval(h *History, lag int) float64
+}
+
+type number float64
+
+func (n number) eval(*History, int) float64 { return float64(n) }
+
+type ref struct {
+	name string
+	back int
+}
+
+func (r ref) eval(h *History, lag int) float64 { return h.Value(r.name, r.back+lag) }
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (u unary) eval(h *History, lag int) float64 {
+	v := u.operand.eval(h, lag)
+	switch u.op {
+	case "-":
+		return -v
+	default: // "!"
+		if math.IsNaN(v) {
+			return math.NaN()
+		}
+		return boolean(!truthy(v))
+	}
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (b binary) eval(h *History, lag int) float64 {
+	switch b.op {
+	case "&&":
+		return boolean(truthy(b.left.eval(h, lag)) && truthy(b.right.eval(h, lag)))
+	case "||":
+		return boolean(truthy(b.left.eval(h, lag)) || truthy(b.right.eval(h, lag)))
+	case "crosses_above", "crosses_below":
+		now, prev := b.left.eval(h, lag)-b.right.eval(h, lag), b.left.eval(h, lag+1)-b.right.eval(h, lag+1)
+		if math.IsNaN(now) || math.IsNaN(prev) {
+			return 0
+		}
+		if b.op == "crosses_above" {
+			return boolean(now > 0 && prev <= 0)
+		}
+		return boolean(now < 0 && prev >= 0)
+	}
+	l, r := b.left.eval(h, lag), b.right.eval(h, lag)
+	switch b.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return math.NaN()
+		}
+		return l / r
+	}
+	if math.IsNaN(l) || math.IsNaN(r) {
+		return 0
+	}
+	switch b.op {
+	case "<":
+		return boolean(l < r)
+	case "<=":
+		return boolean(l <= r)
+	case ">":
+		return boolean(l > r)
+	case ">=":
+		return boolean(l >= r)
+	case "==":
+		return boolean(l == r)
+	default: // "!="
+		return boolean(l != r)
+	}
+}
+
+type call struct {
+	fn   string
+	args []node
+}
+
+func (c call) eval(h *History, lag int) float64 {
+	switch c.fn {
+	case "abs":
+		return math.Abs(c.args[0].eval(h, lag))
+	case "min":
+		return math.Min(c.args[0].eval(h, lag), c.args[1].eval(h, lag))
+	default: // "max"
+		return math.Max(c.args[0].eval(h, lag), c.args[1].eval(h, lag))
+	}
+}
+
+var arity = map[string]int{"abs": 1, "min": 2, "max": 2}
+
+func truthy(v float64) bool {
+	return v != 0 && !math.IsNaN(v)
+}
+
+func boolean(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenName
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// Operators, longest first so "<=" is not read as "<".
+var operators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "!", "+", "-", "*", "/", "(", ")", "[", "]", ","}
+
+// Word spellings of operators.
+var keywords = map[string]string{"and": "&&", "or": "||", "not": "!"}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.' ||
+				src[j] == 'e' || src[j] == 'E' || (j > i && (src[j] == '-' || src[j] == '+') && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			word := src[i:j]
+			if op, ok := keywords[strings.ToLower(word)]; ok {
+				tokens = append(tokens, token{kind: tokenOp, text: op})
+			} else {
+				tokens = append(tokens, token{kind: tokenName, text: word})
+			}
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokenOp, text: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at offset %d", src[i], i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEnd}), nil
+}
+
+// parser is a recursive-descent parser, lowest precedence first:
+// or, and, not, comparison/cross, sum, product, unary minus, primary.
+type parser struct {
+	tokens []token
+	pos    int
+	// shift is how many bars back the term being parsed is also read, from
+	// enclosing crosses.
+	shift int
+	lags  map[string]int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return fmt.Errorf("expected %q, found %q", op, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right node
+		if right, err = p.parseAnd(); err == nil {
+			left = binary{op: "||", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("&&") {
+		var right node
+		if right, err = p.parseNot(); err == nil {
+			left = binary{op: "&&", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		return unary{op: "!", operand: operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	start := p.pos
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokenName && (t.text == "crosses_above" || t.text == "crosses_below") {
+		p.next()
+		// Crosses read both operands one bar back as well; reparse the left
+		// side so its lookbacks count the extra bar.
+		end := p.pos
+		p.pos, p.shift = start, p.shift+1
+		if left, err = p.parseSum(); err != nil {
+			return nil, err
+		}
+		p.pos = end
+		right, err := p.parseSum()
+		p.shift--
+		return binary{op: t.text, left: left, right: right}, err
+	}
+	for _, op := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.parseSum()
+			return binary{op: op, left: left, right: right}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	for err == nil {
+		op := p.peek().text
+		if p.peek().kind != tokenOp || (op != "+" && op != "-") {
+			break
+		}
+		p.next()
+		var right node
+		if right, err = p.parseProduct(); err == nil {
+			left = binary{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	for err == nil {
+		op := p.peek().text
+		if p.peek().kind != tokenOp || (op != "*" && op != "/") {
+			break
+		}
+		p.next()
+		var right node
+		if right, err = p.parseUnary(); err == nil {
+			left = binary{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		return unary{op: "-", operand: operand}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", t.text)
+		}
+		return number(v), nil
+	case tokenName:
+		if n, ok := arity[t.text]; ok && p.accept("(") {
+			return p.parseCall(t.text, n)
+		}
+		switch t.text {
+		case "true":
+			return number(1), nil
+		case "false":
+			return number(0), nil
+		case "crosses_above", "crosses_below":
+			return nil, fmt.Errorf("%s needs a left operand", t.text)
+		}
+		back := 0
+		if p.accept("[") {
+			n := p.next()
+			v, err := strconv.Atoi(n.text)
+			if n.kind != tokenNumber || err != nil || v < 0 {
+				return nil, fmt.Errorf("lookback for %s must be a whole number of bars", t.text)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			back = v
+		}
+		if need := back + p.shift; need >= p.lags[t.text] {
+			p.lags[t.text] = need
+		}
+		return ref{name: t.text, back: back}, nil
+	case tokenOp:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	default:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+}
+
+func (p *parser) parseCall(fn string, n int) (node, error) {
+	args := make([]node, 0, n)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return call{fn: fn, args: args}, p.expect(")")
+}
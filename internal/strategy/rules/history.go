@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"math"
+
+	"trading-algo-generator/internal/core"
+)
+
+// History keeps the recent values of every name the rules read, newest
+// first. Names are feature names, or open, high, low, close and volume for
+// the bar itself.
+type History struct {
+	depth  map[string]int
+	Values map[string][]float64
+}
+
+// NewHistory returns an empty history; Need sets what it keeps.
+func NewHistory() *History {
+	return &History{depth: map[string]int{}, Values: map[string][]float64{}}
+}
+
+// Need extends the history to cover an expression's lookbacks.
+func (h *History) Need(lags map[string]int) {
+	for name, lag := range lags {
+		if current, ok := h.depth[name]; !ok || lag > current {
+			h.depth[name] = lag
+		}
+	}
+}
+
+// Push records a bar.
+func (h *History) Push(tick core.Tick, features core.FeatureSet) {
+	for name, depth := range h.depth {
+		value, ok := features.Values[name]
+		if !ok {
+			value = barValue(tick, name)
+		}
+		series := append([]float64{value}, h.Values[name]...)
+		if len(series) > depth+1 {
+			series = series[:depth+1]
+		}
+		h.Values[name] = series
+	}
+}
+
+// Value is name's value back bars ago, or NaN when it is missing or not
+// yet seen.
+func (h *History) Value(name string, back int) float64 {
+	series := h.Values[name]
+	if back >= len(series) {
+		return math.NaN()
+	}
+	return series[back]
+}
+
+// barFields are the names barValue reads from the bar itself.
+var barFields = []string{"open", "high", "low", "close", "volume"}
+
+func barValue(tick core.Tick, name string) float64 {
+	switch name {
+	case "open":
+		return tick.Open
+	case "high":
+		return tick.High
+	case "low":
+		return tick.Low
+	case "close":
+		return tick.Close
+	case "volume":
+		return float64(tick.Volume)
+	default:
+		return math.NaN()
+	}
+}
@@ -0,0 +1,246 @@
+// Package rules is a strategy defined entirely in config: entry and exit
+// conditions are expressions over feature values, compiled once when the
+// strategy is built and evaluated on every bar.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"trading-algo-generator/internal/core"
+	"trading-algo-generator/internal/features"
+	"trading-algo-generator/internal/strategy"
+)
+
+// DefaultConfidence is used by rules that set none.
+const DefaultConfidence = 0.6
+
+// Config lists the rules for each decision. Within a list the first rule
+// whose condition holds fires, so a list is an OR of its rules.
+type Config struct {
+	Long      []Rule `doc:"rules that open a long position when flat"`
+	Short     []Rule `doc:"rules that open a short position when flat"`
+	ExitLong  []Rule `doc:"rules that close a long position"`
+	ExitShort []Rule `doc:"rules that close a short position"`
+}
+
+// Rule is a condition and the signal it produces. The condition is When,
+// every expression in All and at least one in Any, each part optional but
+// not all empty.
+type Rule struct {
+	When string
+	All  []string
+	Any  []string
+	// Confidence defaults to DefaultConfidence; exits ignore it.
+	Confidence float64
+	// Reason defaults to the list and rule number, e.g. long_1.
+	Reason string
+}
+
+// knownNames are the names an expression may read: the bar's fields and
+// every feature the default generators produce.
+var knownNames = func() map[string]bool {
+	known := map[string]bool{}
+	for _, name := range append(append([]string(nil), barFields...), features.Names()...) {
+		known[name] = true
+	}
+	return known
+}()
+
+func init() {
+	strategy.Register("rules", "Enters and exits on expressions over feature values, defined in config.",
+		Config{},
+		func(params Config) (strategy.Strategy, error) { return New(params) })
+}
+
+// Strategy evaluates compiled rules against a rolling history of the values
+// they read.
+type Strategy struct {
+	Config Config
+
+	long, short, exitLong, exitShort []compiled
+	history                          *History
+}
+
+type compiled struct {
+	all, any   []*Expr
+	confidence float64
+	reason     string
+}
+
+// New compiles a rules config.
+func New(cfg Config) (*Strategy, error) {
+	if len(cfg.Long) == 0 && len(cfg.Short) == 0 {
+		return nil, fmt.Errorf("rules strategy needs at least one Long or Short rule")
+	}
+	s := &Strategy{Config: cfg, history: NewHistory()}
+	var err error
+	if s.long, err = s.compile("long", cfg.Long); err != nil {
+		return nil, err
+	}
+	if s.short, err = s.compile("short", cfg.Short); err != nil {
+		return nil, err
+	}
+	if s.exitLong, err = s.compile("exit_long", cfg.ExitLong); err != nil {
+		return nil, err
+	}
+	if s.exitShort, err = s.compile("exit_short", cfg.ExitShort); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Strategy) compile(list string, rules []Rule) ([]compiled, error) {
+	out := make([]compiled, 0, len(rules))
+	for i, rule := range rules {
+		c := compiled{confidence: rule.Confidence, reason: rule.Reason}
+		if c.confidence == 0 {
+			c.confidence = DefaultConfidence
+		}
+		if c.confidence < 0 || c.confidence > 1 {
+			return nil, fmt.Errorf("rules %s %d: confidence %g outside 0..1", list, i+1, rule.Confidence)
+		}
+		if c.reason == "" {
+			c.reason = fmt.Sprintf("%s_%d", list, i+1)
+		}
+		all := rule.All
+		if rule.When != "" {
+			all = append([]string{rule.When}, all...)
+		}
+		if len(all) == 0 && len(rule.Any) == 0 {
+			return nil, fmt.Errorf("rules %s %d: no condition", list, i+1)
+		}
+		for _, group := range []struct {
+			src  []string
+			dest *[]*Expr
+		}{{all, &c.all}, {rule.Any, &c.any}} {
+			for _, src := range group.src {
+				expr, err := Compile(src)
+				if err != nil {
+					return nil, fmt.Errorf("rules %s %d: %w", list, i+1, err)
+				}
+				if err := checkNames(expr); err != nil {
+					return nil, fmt.Errorf("rules %s %d: %w", list, i+1, err)
+				}
+				s.history.Need(expr.lags)
+				*group.dest = append(*group.dest, expr)
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// checkNames rejects expressions that read names no bar or feature has, so
+// a typo fails the config load instead of never firing.
+func checkNames(expr *Expr) error {
+	var unknown []string
+	for name := range expr.lags {
+		if !knownNames[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("%q reads unknown name %s (want a feature name or %s)", expr.src, strings.Join(unknown, ", "), strings.Join(barFields, ", "))
+}
+
+// holds reports whether the rule's condition is true on the latest bar.
+func (c compiled) holds(h *History) bool {
+	for _, expr := range c.all {
+		if !expr.True(h) {
+			return false
+		}
+	}
+	if len(c.any) == 0 {
+		return true
+	}
+	for _, expr := range c.any {
+		if expr.True(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// first is the first rule in the list that holds.
+func first(rules []compiled, h *History) (compiled, bool) {
+	for _, rule := range rules {
+		if rule.holds(h) {
+			return rule, true
+		}
+	}
+	return compiled{}, false
+}
+
+func (s *Strategy) Name() string { return "rules" }
+
+func (s *Strategy) OnTick(tick core.Tick, features core.FeatureSet, position core.Position) *core.Signal {
+	s.history.Push(tick, features)
+	if position.Open {
+		exits := s.exitLong
+		if position.Direction == core.Short {
+			exits = s.exitShort
+		}
+		if rule, ok := first(exits, s.history); ok {
+			return &core.Signal{Timestamp: tick.Timestamp, Direction: position.Direction, Intent: core.Exit, Reason: rule.reason}
+		}
+		return nil
+	}
+	if rule, ok := first(s.long, s.history); ok {
+		return &core.Signal{Timestamp: tick.Timestamp, Direction: core.Long, Confidence: rule.confidence, Reason: rule.reason}
+	}
+	if rule, ok := first(s.short, s.history); ok {
+		return &core.Signal{Timestamp: tick.Timestamp, Direction: core.Short, Confidence: rule.confidence, Reason: rule.reason}
+	}
+	return nil
+}
+
+// EntryValid holds while any entry rule for the position's direction still
+// holds.
+func (s *Strategy) EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool {
+	rules := s.long
+	if direction == core.Short {
+		rules = s.short
+	}
+	_, ok := first(rules, s.history)
+	return ok
+}
+
+// Snapshot saves the history; missing values are saved as null.
+func (s *Strategy) Snapshot() (json.RawMessage, error) {
+	values := make(map[string][]*float64, len(s.history.Values))
+	for name, series := range s.history.Values {
+		saved := make([]*float64, len(series))
+		for i := range series {
+			if !math.IsNaN(series[i]) {
+				saved[i] = &series[i]
+			}
+		}
+		values[name] = saved
+	}
+	return json.Marshal(values)
+}
+
+func (s *Strategy) Restore(data json.RawMessage) error {
+	var values map[string][]*float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for name, saved := range values {
+		series := make([]float64, len(saved))
+		for i, v := range saved {
+			series[i] = math.NaN()
+			if v != nil {
+				series[i] = *v
+			}
+		}
+		s.history.Values[name] = series
+	}
+	return nil
+}
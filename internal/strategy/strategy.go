@@ -2,8 +2,24 @@ package strategy
 
 import "trading-algo-generator/internal/core"
 
-// Strategy consumes ticks and features to emit signals.
+// Strategy consumes ticks and features to emit signals. Strategies with
+// rolling state also implement core.Snapshotter so live runs can checkpoint
+// and resume them.
 type Strategy interface {
 	Name() string
 	OnTick(tick core.Tick, features core.FeatureSet, position core.Position) *core.Signal
 }
+
+// OrderEventHandler is implemented by strategies that want to hear about
+// their working entry orders: acceptance, fills, cancels and expiries.
+type OrderEventHandler interface {
+	OnOrderEvent(event core.OrderEvent)
+}
+
+// EntryConditionChecker is implemented by strategies that can tell whether
+// the condition behind an open position's entry still holds. The engine
+// calls it after OnTick on every bar a position is open and uses it for
+// signal-decay exits.
+type EntryConditionChecker interface {
+	EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool
+}
@@ -0,0 +1,140 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"trading-algo-generator/internal/core"
+)
+
+// VWAPConfig controls the VWAP template. Bands are in standard deviations
+// of price around the session VWAP from the vwap features; prices are in
+// points.
+type VWAPConfig struct {
+	Mode       string  `doc:"fade, reclaim or both"`
+	FadeBand   float64 `doc:"band beyond which closes are faded back toward the VWAP"`
+	MaxBand    float64 `doc:"band beyond which nothing is faded, as the day is trending (0: no limit)"`
+	Tolerance  float64 `doc:"how close to the VWAP a bar must trade to count as testing it"`
+	MinStdDev  float64 `doc:"smallest VWAP standard deviation worth trading"`
+	RTHOnly    bool    `doc:"only enter on ticks labelled RTH"`
+	ExitAtVWAP bool    `doc:"close fades when price gets back to the VWAP"`
+	Confidence float64 `doc:"signal confidence"`
+}
+
+func init() {
+	Register("vwap", "Fades the session VWAP's outer bands, or trades reclaims and rejections of the VWAP.",
+		VWAPConfig{Mode: "fade", FadeBand: 2, MaxBand: 3, Confidence: 0.6},
+		func(params VWAPConfig) (Strategy, error) {
+			switch strings.ToLower(params.Mode) {
+			case "fade", "reclaim", "both":
+			default:
+				return nil, fmt.Errorf("vwap mode %q (want fade, reclaim or both)", params.Mode)
+			}
+			return &VWAPStrategy{Config: params}, nil
+		})
+}
+
+// VWAPStrategy trades around the session-anchored VWAP. Fades enter against
+// closes between FadeBand and MaxBand deviations from it; reclaims enter when
+// the close crosses the VWAP, and rejections when a bar tests the VWAP and
+// closes back on the side it came from.
+type VWAPStrategy struct {
+	Config VWAPConfig
+	State  VWAPState
+}
+
+// VWAPState is the previous bar's close and VWAP, and the kind of the last
+// entry signalled ("fade" or "reclaim").
+type VWAPState struct {
+	Close float64
+	VWAP  float64
+	Kind  string
+}
+
+func (s *VWAPStrategy) Name() string { return "vwap" }
+
+func (s *VWAPStrategy) OnTick(tick core.Tick, features core.FeatureSet, position core.Position) *core.Signal {
+	vwap, ok := features.Values["vwap"]
+	if !ok {
+		return nil
+	}
+	sd := features.Values["vwap_sd"]
+	prev := s.State
+	// The first bar of a session has no previous bar on the same VWAP.
+	hasPrev := features.Values["vwap_bars"] >= 2 && prev.VWAP != 0
+	s.State.Close, s.State.VWAP = tick.Close, vwap
+
+	if position.Open {
+		if s.Config.ExitAtVWAP && s.State.Kind == "fade" &&
+			((position.Direction == core.Long && tick.Close >= vwap) || (position.Direction == core.Short && tick.Close <= vwap)) {
+			return &core.Signal{Timestamp: tick.Timestamp, Direction: position.Direction, Intent: core.Exit, Reason: "vwap_target"}
+		}
+		return nil
+	}
+	if s.Config.RTHOnly && !strings.EqualFold(tick.Session, "RTH") {
+		return nil
+	}
+	if sd <= 0 || sd < s.Config.MinStdDev {
+		return nil
+	}
+
+	mode := strings.ToLower(s.Config.Mode)
+	if mode != "reclaim" {
+		z := (tick.Close - vwap) / sd
+		if math.Abs(z) >= s.Config.FadeBand && (s.Config.MaxBand <= 0 || math.Abs(z) < s.Config.MaxBand) {
+			if z > 0 {
+				return s.signal(tick, core.Short, "fade", "vwap_fade_high")
+			}
+			return s.signal(tick, core.Long, "fade", "vwap_fade_low")
+		}
+	}
+	if mode != "fade" && hasPrev {
+		tol := s.Config.Tolerance
+		switch {
+		case prev.Close <= prev.VWAP && tick.Close > vwap:
+			return s.signal(tick, core.Long, "reclaim", "vwap_reclaim")
+		case prev.Close >= prev.VWAP && tick.Close < vwap:
+			return s.signal(tick, core.Short, "reclaim", "vwap_lost")
+		case prev.Close > prev.VWAP && tick.Close > vwap && tick.Low <= vwap+tol:
+			return s.signal(tick, core.Long, "reclaim", "vwap_rejection_long")
+		case prev.Close < prev.VWAP && tick.Close < vwap && tick.High >= vwap-tol:
+			return s.signal(tick, core.Short, "reclaim", "vwap_rejection_short")
+		}
+	}
+	return nil
+}
+
+func (s *VWAPStrategy) signal(tick core.Tick, direction core.Direction, kind, reason string) *core.Signal {
+	s.State.Kind = kind
+	confidence := s.Config.Confidence
+	if confidence <= 0 {
+		confidence = 0.6
+	}
+	return &core.Signal{Timestamp: tick.Timestamp, Direction: direction, Confidence: confidence, Reason: reason}
+}
+
+// EntryValid holds for fades while price stays inside MaxBand, and for
+// reclaims while the close stays on the trade's side of the VWAP.
+func (s *VWAPStrategy) EntryValid(tick core.Tick, features core.FeatureSet, direction core.Direction) bool {
+	vwap, ok := features.Values["vwap"]
+	if !ok {
+		return true
+	}
+	if s.State.Kind == "fade" {
+		return s.Config.MaxBand <= 0 || math.Abs(features.Values["vwap_z"]) < s.Config.MaxBand
+	}
+	if direction == core.Long {
+		return tick.Close > vwap
+	}
+	return tick.Close < vwap
+}
+
+func (s *VWAPStrategy) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(s.State)
+}
+
+func (s *VWAPStrategy) Restore(data json.RawMessage) error {
+	return json.Unmarshal(data, &s.State)
+}